@@ -0,0 +1,211 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var cellHighlightColor = rl.NewColor(250, 215, 90, 255)
+var cellNegativeColor = rl.NewColor(240, 95, 85, 255)
+var cellDarkTextColor = rl.NewColor(40, 34, 45, 255)
+
+type CellFormatKind int
+
+const (
+	ColorScale  CellFormatKind = iota // shades numbers from lowest to highest
+	DataBars                          // draws a bar behind numbers, sized by value
+	Highlight                         // fills in cells matching a condition
+	NegativeRed                       // writes negative numbers in red
+)
+
+var cellFormatKindOpts = []raygui.DropdownExOption{
+	{"Color scale", ColorScale},
+	{"Data bars", DataBars},
+	{"Highlight if", Highlight},
+	{"Negatives in red", NegativeRed},
+}
+
+// CellFormat A conditional formatting rule for one column of a results grid.
+type CellFormat struct {
+	Col       string
+	Kind      CellFormatKind
+	Condition string // for Highlight, e.g. "> 100" or "= PG"
+
+	ColDropdown      raygui.DropdownEx
+	KindDropdown     raygui.DropdownEx
+	ConditionTextbox raygui.TextBoxEx
+}
+
+// Matches Checks a value against the rule's condition: an operator (=, !=,
+// <>, <, <=, >, or >=, with = if there isn't one) and something to compare
+// with. Values are compared as numbers when both sides are numbers, and as
+// text otherwise.
+func (f *CellFormat) Matches(v interface{}) bool {
+	cond := strings.TrimSpace(f.Condition)
+	if cond == "" {
+		return false
+	}
+
+	op := "="
+	for _, candidate := range []string{"!=", "<>", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(cond, candidate) {
+			op = candidate
+			cond = strings.TrimSpace(cond[len(candidate):])
+			break
+		}
+	}
+	if len(cond) >= 2 && (cond[0] == '\'' || cond[0] == '"') && cond[len(cond)-1] == cond[0] {
+		cond = cond[1 : len(cond)-1]
+	}
+
+	var cmp int
+	a, aok := sqlNumber(v)
+	b, err := strconv.ParseFloat(cond, 64)
+	if aok && err == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(cellText(v), cond)
+	}
+
+	switch op {
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Gets a number out of a value only if it's stored as one. Numbers in text
+// columns stay text.
+func cellNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	default:
+		return 0, false
+	}
+}
+
+// cellText Formats a value for the results grid, with commas between the
+// thousands of numbers.
+func cellText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return groupThousands(strconv.FormatInt(val, 10))
+	case float64:
+		return groupThousands(strconv.FormatFloat(val, 'f', -1, 64))
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func groupThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+	if len(whole) == 0 || whole[0] < '0' || whole[0] > '9' {
+		return sign + s // NaN or Inf
+	}
+
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String() + frac
+}
+
+// The smallest and largest numbers in a column, for color scales and data
+// bars. Min is NaN when there aren't any.
+type cellRange struct {
+	Min, Max float64
+}
+
+// drawFormattedCell Draws the background of a cell according to the rules
+// for its column, and returns the color to write its text in.
+func drawFormattedCell(cell rl.Rectangle, v interface{}, formats []*CellFormat, col string, colRange cellRange) rl.Color {
+	textColor := PaneFontColor
+	num, isNumber := cellNumber(v)
+
+	for _, f := range formats {
+		if f.Col != col {
+			continue
+		}
+
+		switch f.Kind {
+		case ColorScale:
+			if !isNumber || math.IsNaN(colRange.Min) {
+				continue
+			}
+			color := heatmapColor(num, colRange.Min, math.Max(colRange.Max, colRange.Min+1e-9))
+			rl.DrawRectangleRec(cell, color)
+			textColor = cellDarkTextColor
+			if isDarkColor(color) {
+				textColor = rl.White
+			}
+		case DataBars:
+			if !isNumber || math.IsNaN(colRange.Min) {
+				continue
+			}
+			// Bars grow out from zero, which is at the left edge unless
+			// there are negative numbers.
+			lo, hi := math.Min(colRange.Min, 0), math.Max(colRange.Max, 0)
+			if hi == lo {
+				continue
+			}
+			inner := rl.Rectangle{cell.X + 2, cell.Y + 4, cell.Width - 4, cell.Height - 8}
+			zeroX := inner.X + inner.Width*float32(-lo/(hi-lo))
+			valueX := inner.X + inner.Width*float32((num-lo)/(hi-lo))
+			color := chartColor(0)
+			if num < 0 {
+				color = heatmapNegative
+			}
+			rl.DrawRectangleRec(rl.Rectangle{
+				float32(math.Min(float64(zeroX), float64(valueX))),
+				inner.Y,
+				float32(math.Abs(float64(valueX - zeroX))),
+				inner.Height,
+			}, rl.ColorAlpha(color, 0.6))
+		case Highlight:
+			if f.Matches(v) {
+				rl.DrawRectangleRec(cell, cellHighlightColor)
+				textColor = cellDarkTextColor
+			}
+		case NegativeRed:
+			if isNumber && num < 0 {
+				textColor = cellNegativeColor
+			}
+		}
+	}
+
+	return textColor
+}
@@ -0,0 +1,1071 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type ChartType int
+
+const (
+	BarChart ChartType = iota
+	HorizontalBarChart
+	LineChart
+	AreaChart
+	ScatterChart
+	PieChart
+	DonutChart
+	HeatmapChart
+)
+
+// chartData What a chart shows, pulled out of the query result so that the
+// renderers don't care where it came from.
+type chartData struct {
+	Labels  []string  // one per category, for everything but scatter charts
+	XValues []float64 // one per point, for scatter charts
+	Times   []float64 // one per label in Unix seconds, when the labels are dates
+	Series  []chartSeries
+	Stacked bool // stack series on top of each other instead of side by side
+
+	XTitle     string
+	YTitle     string
+	ValueTitle string // what the colors mean, for heatmaps
+
+	TimeView *chartTimeView // the zoomed in part of a time axis, if any
+
+	// Labels picked by clicking. While there are any, the rest fade out.
+	Selected map[string]bool
+}
+
+func (d *chartData) labelColor(label string, color rl.Color) rl.Color {
+	if len(d.Selected) > 0 && !d.Selected[label] {
+		return withAlpha(color, 0.3)
+	}
+	return color
+}
+
+type chartSeries struct {
+	Name   string
+	Values []float64 // one per label or x value, NaN where missing
+}
+
+// chartCanvas Something a chart can be drawn onto. The renderers only draw
+// through this, never with raylib directly.
+type chartCanvas interface {
+	Rect(r rl.Rectangle, color rl.Color)
+	Line(start, end rl.Vector2, thick float32, color rl.Color)
+	Circle(center rl.Vector2, radius float32, color rl.Color)
+	Polygon(points []rl.Vector2, color rl.Color) // points must make a convex shape
+	// Angles are in radians, clockwise from the positive x axis.
+	Sector(center rl.Vector2, innerRadius, outerRadius, startAngle, endAngle float32, color rl.Color)
+	Text(text string, pos rl.Vector2, size float32, color rl.Color)
+	// pos is the top left of the text before it is turned clockwise around
+	// it, in degrees.
+	RotatedText(text string, pos rl.Vector2, size float32, degrees float32, color rl.Color)
+	MeasureText(text string, size float32) rl.Vector2
+}
+
+// rlChartCanvas Draws charts to the screen with raylib.
+type rlChartCanvas struct{}
+
+var _ chartCanvas = rlChartCanvas{}
+
+func (rlChartCanvas) Rect(r rl.Rectangle, color rl.Color) {
+	rl.DrawRectangleRec(r, color)
+}
+
+func (rlChartCanvas) Line(start, end rl.Vector2, thick float32, color rl.Color) {
+	rl.DrawLineEx(start, end, thick, color)
+}
+
+func (rlChartCanvas) Circle(center rl.Vector2, radius float32, color rl.Color) {
+	rl.DrawCircleV(center, radius, color)
+}
+
+func (rlChartCanvas) Polygon(points []rl.Vector2, color rl.Color) {
+	for i := 2; i < len(points); i++ {
+		drawTriangleAnyWinding(points[0], points[i-1], points[i], color)
+	}
+}
+
+func (c rlChartCanvas) Sector(center rl.Vector2, innerRadius, outerRadius, startAngle, endAngle float32, color rl.Color) {
+	const maxStep = math.Pi / 32
+	steps := int(math.Ceil(float64((endAngle - startAngle) / maxStep)))
+	if steps < 1 {
+		steps = 1
+	}
+	step := (endAngle - startAngle) / float32(steps)
+
+	for i := 0; i < steps; i++ {
+		a0 := startAngle + float32(i)*step
+		a1 := a0 + step
+		outer0, outer1 := pointOnCircle(center, outerRadius, a0), pointOnCircle(center, outerRadius, a1)
+		if innerRadius <= 0 {
+			drawTriangleAnyWinding(center, outer0, outer1, color)
+		} else {
+			c.Polygon([]rl.Vector2{
+				pointOnCircle(center, innerRadius, a0),
+				outer0,
+				outer1,
+				pointOnCircle(center, innerRadius, a1),
+			}, color)
+		}
+	}
+}
+
+func (rlChartCanvas) Text(text string, pos rl.Vector2, size float32, color rl.Color) {
+	drawBasicText(text, pos.X, pos.Y, size, color)
+}
+
+func (rlChartCanvas) RotatedText(text string, pos rl.Vector2, size float32, degrees float32, color rl.Color) {
+	drawRotatedBasicText(text, pos, size, degrees, color)
+}
+
+func (rlChartCanvas) MeasureText(text string, size float32) rl.Vector2 {
+	return measureBasicText(text, size)
+}
+
+// raylib only fills triangles whose points go counter-clockwise on screen.
+func drawTriangleAnyWinding(a, b, c rl.Vector2, color rl.Color) {
+	if (b.X-a.X)*(c.Y-a.Y)-(b.Y-a.Y)*(c.X-a.X) > 0 {
+		b, c = c, b
+	}
+	rl.DrawTriangle(a, b, c, color)
+}
+
+func pointOnCircle(center rl.Vector2, radius float32, angle float32) rl.Vector2 {
+	return rl.Vector2{
+		X: center.X + radius*float32(math.Cos(float64(angle))),
+		Y: center.Y + radius*float32(math.Sin(float64(angle))),
+	}
+}
+
+const chartTextSize = 14
+const chartPadding = 8
+
+// Colors for charts with more than one thing to tell apart.
+var chartPalette = []rl.Color{
+	rl.NewColor(31, 119, 180, 255),
+	rl.NewColor(255, 127, 14, 255),
+	rl.NewColor(44, 160, 44, 255),
+	rl.NewColor(214, 39, 40, 255),
+	rl.NewColor(148, 103, 189, 255),
+	rl.NewColor(140, 86, 75, 255),
+	rl.NewColor(227, 119, 194, 255),
+	rl.NewColor(127, 127, 127, 255),
+}
+
+func chartColor(i int) rl.Color {
+	return chartPalette[i%len(chartPalette)]
+}
+
+func withAlpha(c rl.Color, alpha float32) rl.Color {
+	c.A = uint8(float32(c.A) * alpha)
+	return c
+}
+
+// drawChart Draws a chart of any type within bounds, returning marks for the
+// values it drew. ink is used for text, axes, and the data itself when there
+// is only one thing to draw.
+func drawChart(cv chartCanvas, bounds rl.Rectangle, typ ChartType, data *chartData, ink rl.Color) []chartMark {
+	if len(data.Series) == 0 || len(data.Labels) == 0 && len(data.XValues) == 0 {
+		drawChartMessage(cv, bounds, "No data", ink)
+		return nil
+	}
+
+	// Pie charts get their own legend, of slices instead of series, and
+	// heatmaps have a color scale instead.
+	if len(data.Series) > 1 && typ != PieChart && typ != DonutChart && typ != HeatmapChart {
+		names := make([]string, len(data.Series))
+		for i, s := range data.Series {
+			names[i] = s.Name
+		}
+		bounds = drawSeriesLegend(cv, bounds, names, ink)
+	}
+
+	switch typ {
+	case PieChart, DonutChart:
+		return drawPieChart(cv, bounds, data, typ == DonutChart, ink)
+	case ScatterChart:
+		return drawScatterChart(cv, bounds, data, ink)
+	case HeatmapChart:
+		return drawHeatmap(cv, bounds, data, ink)
+	default:
+		if data.Times != nil && typ.CanPlotTime() {
+			return drawTimeChart(cv, bounds, typ, data, ink)
+		}
+		return drawCategoryChart(cv, bounds, typ, data, ink)
+	}
+}
+
+// Draws a legend of series names down the right side of bounds, returning
+// what's left of bounds for the chart itself.
+func drawSeriesLegend(cv chartCanvas, bounds rl.Rectangle, names []string, ink rl.Color) rl.Rectangle {
+	entries := make([]chartLegendEntry, len(names))
+	for i, name := range names {
+		entries[i] = chartLegendEntry{Label: name, Color: chartColor(i)}
+	}
+	legendWidth := float32(math.Min(float64(chartLegendWidth(cv, entries)), float64(bounds.Width*0.3)))
+	drawChartLegend(cv, rl.Rectangle{
+		bounds.X + bounds.Width - legendWidth,
+		bounds.Y,
+		legendWidth,
+		bounds.Height,
+	}, entries, ink)
+	bounds.Width -= legendWidth + 2*chartPadding
+	return bounds
+}
+
+func drawChartMessage(cv chartCanvas, bounds rl.Rectangle, msg string, ink rl.Color) {
+	size := cv.MeasureText(msg, chartTextSize)
+	cv.Text(msg, rl.Vector2{
+		X: bounds.X + bounds.Width/2 - size.X/2,
+		Y: bounds.Y + bounds.Height/2 - size.Y/2,
+	}, chartTextSize, ink)
+}
+
+// chartAxis Maps data values onto a stretch of the screen. Value axes are
+// labeled with evenly spaced ticks; category axes have one slot per label.
+type chartAxis struct {
+	Min, Max   float64
+	Step       float64  // the distance between ticks, for value axes
+	Labels     []string // one per slot, for category axes
+	TimeStep   timeStep // the calendar step between ticks, for time axes
+	Title      string
+	Start, End float32 // the screen coordinates Min and Max end up at
+
+	// How the labels fit, worked out by layoutChartAxes.
+	labelEvery    int // only every nth category is labeled
+	labelRotated  bool
+	labelMaxWidth float32
+}
+
+// newValueAxis Makes an axis covering min to max, widened out to round
+// numbers, with room for a tick every labelSize along length.
+func newValueAxis(min, max float64, length float32, labelSize float32, title string) chartAxis {
+	maxTicks := int(length / labelSize)
+	if maxTicks < 2 {
+		maxTicks = 2
+	} else if maxTicks > 10 {
+		maxTicks = 10
+	}
+
+	step := niceStep((max - min) / float64(maxTicks))
+	return chartAxis{
+		Min:   math.Floor(min/step+1e-9) * step,
+		Max:   math.Ceil(max/step-1e-9) * step,
+		Step:  step,
+		Title: title,
+	}
+}
+
+func newCategoryAxis(labels []string, title string) chartAxis {
+	return chartAxis{
+		Min:    0,
+		Max:    float64(len(labels)),
+		Labels: labels,
+		Title:  title,
+	}
+}
+
+// Rounds a step up to 1, 2, or 5 times a power of ten, so that ticks land on
+// the numbers a person would have picked.
+func niceStep(raw float64) float64 {
+	if !(raw > 0) || math.IsInf(raw, 0) {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch f := raw / magnitude; {
+	case f <= 1:
+		return magnitude
+	case f <= 2:
+		return 2 * magnitude
+	case f <= 5:
+		return 5 * magnitude
+	default:
+		return 10 * magnitude
+	}
+}
+
+func (a chartAxis) IsCategory() bool {
+	return a.Labels != nil
+}
+
+func (a chartAxis) IsTime() bool {
+	return a.TimeStep.Count > 0
+}
+
+func (a chartAxis) Pos(v float64) float32 {
+	if a.Max == a.Min {
+		return (a.Start + a.End) / 2
+	}
+	return a.Start + float32((v-a.Min)/(a.Max-a.Min))*(a.End-a.Start)
+}
+
+// Ticks Gets the values to label along a value or time axis.
+func (a chartAxis) Ticks() []float64 {
+	if a.IsTime() {
+		var ticks []float64
+		for t := a.TimeStep.Floor(unixTime(a.Min)); float64(t.Unix()) <= a.Max && len(ticks) < 1000; t = a.TimeStep.Next(t) {
+			if v := float64(t.Unix()); v >= a.Min {
+				ticks = append(ticks, v)
+			}
+		}
+		return ticks
+	}
+	if a.IsCategory() || a.Step <= 0 {
+		return nil
+	}
+	ticks := make([]float64, int(math.Round((a.Max-a.Min)/a.Step))+1)
+	for i := range ticks {
+		ticks[i] = a.Min + float64(i)*a.Step
+		if math.Abs(ticks[i]) < a.Step*1e-9 {
+			ticks[i] = 0 // instead of -0 or 1e-17
+		}
+	}
+	return ticks
+}
+
+// FormatTick Formats a tick with just as many decimals as the step needs,
+// or as a date.
+func (a chartAxis) FormatTick(v float64) string {
+	if a.IsTime() {
+		return a.TimeStep.Format(unixTime(v))
+	}
+	decimals := int(math.Max(0, -math.Floor(math.Log10(a.Step)+1e-9)))
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// The room a horizontal value axis needs for each tick label.
+func valueLabelSize(cv chartCanvas, min, max float64) float32 {
+	widest := math.Max(
+		float64(cv.MeasureText(formatChartValue(min), chartTextSize).X),
+		float64(cv.MeasureText(formatChartValue(max), chartTextSize).X),
+	)
+	return float32(widest) + 4*chartPadding
+}
+
+// Finds the range of the given values, ignoring NaNs. Charts measured from
+// zero (like bars) should always include it.
+func chartValueRange(values []float64, includeZero bool) (min, max float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	if includeZero {
+		min, max = 0, 0
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+
+	if math.IsInf(min, 0) {
+		return 0, 1
+	}
+	if min == max {
+		pad := math.Max(math.Abs(min)*0.1, 1)
+		if min == 0 && includeZero {
+			return 0, pad
+		}
+		return min - pad, max + pad
+	}
+	return min, max
+}
+
+func allSeriesValues(series []chartSeries) []float64 {
+	var values []float64
+	for _, s := range series {
+		values = append(values, s.Values...)
+	}
+	return values
+}
+
+// Whether a chart type can stack its series.
+func (t ChartType) CanStack() bool {
+	return t == BarChart || t == HorizontalBarChart || t == AreaChart
+}
+
+// Whether clicking a chart type's bars or slices selects their labels.
+func (t ChartType) CanSelect() bool {
+	return t == BarChart || t == HorizontalBarChart || t == PieChart || t == DonutChart
+}
+
+// Whether a chart type can place its labels by time, when they are dates.
+func (t ChartType) CanPlotTime() bool {
+	return t == BarChart || t == LineChart || t == AreaChart
+}
+
+// The totals a stacked chart reaches at each point, positive values stacking
+// up and negative values stacking down.
+func stackedTotals(series []chartSeries) []float64 {
+	var totals []float64
+	for i := range series[0].Values {
+		var up, down float64
+		for _, s := range series {
+			if v := s.Values[i]; v > 0 {
+				up += v
+			} else if v < 0 {
+				down += v
+			}
+		}
+		totals = append(totals, up, down)
+	}
+	return totals
+}
+
+func formatChartValue(v float64) string {
+	if math.Abs(v) >= 1000 || v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.3g", v)
+}
+
+// Shortens text with an ellipsis until it fits in maxWidth.
+func fitChartText(cv chartCanvas, text string, size float32, maxWidth float32) string {
+	if cv.MeasureText(text, size).X <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		shortened := strings.TrimSpace(string(runes)) + "..."
+		if cv.MeasureText(shortened, size).X <= maxWidth {
+			return shortened
+		}
+	}
+	return ""
+}
+
+// layoutChartAxes Works out where the plot goes within bounds, leaving room
+// around it for axis labels and titles, and lines the axes up with it.
+func layoutChartAxes(cv chartCanvas, bounds rl.Rectangle, x, y *chartAxis) rl.Rectangle {
+	const sin45 = 0.7071
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	plot := bounds
+
+	// On the left, the y axis title and then its labels.
+	if y.Title != "" {
+		plot.X += textHeight + chartPadding
+		plot.Width -= textHeight + chartPadding
+	}
+	var yLabelWidth float32
+	if y.IsCategory() {
+		yLabelWidth = float32(math.Min(float64(widestChartText(cv, y.Labels)), float64(bounds.Width/4)))
+		y.labelMaxWidth = yLabelWidth
+	} else {
+		var labels []string
+		for _, tick := range y.Ticks() {
+			labels = append(labels, y.FormatTick(tick))
+		}
+		yLabelWidth = widestChartText(cv, labels)
+
+		// Half of the top label sticks up above the plot.
+		plot.Y += textHeight / 2
+		plot.Height -= textHeight / 2
+	}
+	plot.X += yLabelWidth + 2*chartPadding
+	plot.Width -= yLabelWidth + 2*chartPadding
+
+	// Along the bottom, the x axis labels and then its title.
+	if x.Title != "" {
+		plot.Height -= textHeight + chartPadding
+	}
+	xLabelHeight := textHeight
+	if x.IsCategory() {
+		slot := plot.Width / float32(len(x.Labels))
+		widest := widestChartText(cv, x.Labels)
+		x.labelEvery = 1
+		x.labelMaxWidth = slot - chartPadding
+		if widest > x.labelMaxWidth {
+			// Turned labels only need a line's worth of room each across
+			// the axis, but take up more room below it.
+			x.labelRotated = true
+			x.labelEvery = int(math.Ceil(float64(textHeight / sin45 / slot)))
+			xLabelHeight = float32(math.Min(float64(sin45*(widest+textHeight)), float64(bounds.Height/3)))
+			x.labelMaxWidth = xLabelHeight/sin45 - textHeight
+
+			// The first label leans out to the left, past the y axis
+			// labels if they're narrow.
+			lean := sin45*(float32(math.Min(float64(widest), float64(x.labelMaxWidth)))+textHeight/2) - slot/2
+			if extra := lean - (plot.X - bounds.X); extra > 0 {
+				plot.X += extra
+				plot.Width -= extra
+			}
+		}
+	} else if ticks := x.Ticks(); len(ticks) > 0 {
+		// Half of the last label hangs off the right end.
+		plot.Width -= cv.MeasureText(x.FormatTick(ticks[len(ticks)-1]), chartTextSize).X / 2
+	}
+	plot.Height -= xLabelHeight + chartPadding
+
+	x.Start, x.End = plot.X, plot.X+plot.Width
+	if y.IsCategory() {
+		// Categories read top to bottom.
+		y.Start, y.End = plot.Y, plot.Y+plot.Height
+		y.labelEvery = int(math.Ceil(float64(textHeight / (plot.Height / float32(len(y.Labels))))))
+	} else {
+		y.Start, y.End = plot.Y+plot.Height, plot.Y
+	}
+	if x.labelEvery < 1 {
+		x.labelEvery = 1
+	}
+	if y.labelEvery < 1 {
+		y.labelEvery = 1
+	}
+
+	return plot
+}
+
+func widestChartText(cv chartCanvas, texts []string) float32 {
+	var widest float32
+	for _, text := range texts {
+		widest = float32(math.Max(float64(widest), float64(cv.MeasureText(text, chartTextSize).X)))
+	}
+	return widest
+}
+
+// drawChartAxes Draws gridlines, axis lines, labels, and titles for a plot
+// laid out by layoutChartAxes. Done before the data so the gridlines end up
+// underneath it.
+func drawChartAxes(cv chartCanvas, bounds rl.Rectangle, plot rl.Rectangle, x, y chartAxis, ink rl.Color) {
+	const sin45 = 0.7071
+	grid := withAlpha(ink, 0.15)
+	plotBottom := plot.Y + plot.Height
+
+	for _, tick := range y.Ticks() {
+		pos := y.Pos(tick)
+		cv.Line(rl.Vector2{plot.X, pos}, rl.Vector2{plot.X + plot.Width, pos}, 1, grid)
+
+		label := y.FormatTick(tick)
+		size := cv.MeasureText(label, chartTextSize)
+		cv.Text(label, rl.Vector2{plot.X - chartPadding - size.X, pos - size.Y/2}, chartTextSize, ink)
+	}
+	for _, tick := range x.Ticks() {
+		pos := x.Pos(tick)
+		cv.Line(rl.Vector2{pos, plot.Y}, rl.Vector2{pos, plotBottom}, 1, grid)
+
+		label := x.FormatTick(tick)
+		size := cv.MeasureText(label, chartTextSize)
+		cv.Text(label, rl.Vector2{pos - size.X/2, plotBottom + chartPadding}, chartTextSize, ink)
+	}
+
+	for i, label := range y.Labels {
+		if i%y.labelEvery != 0 {
+			continue
+		}
+		text := fitChartText(cv, label, chartTextSize, y.labelMaxWidth)
+		size := cv.MeasureText(text, chartTextSize)
+		center := y.Pos(float64(i) + 0.5)
+		cv.Text(text, rl.Vector2{plot.X - chartPadding - size.X, center - size.Y/2}, chartTextSize, ink)
+	}
+	for i, label := range x.Labels {
+		if i%x.labelEvery != 0 {
+			continue
+		}
+		text := fitChartText(cv, label, chartTextSize, x.labelMaxWidth)
+		size := cv.MeasureText(text, chartTextSize)
+		center := x.Pos(float64(i) + 0.5)
+		top := plotBottom + chartPadding
+		if x.labelRotated {
+			// Turned up and to the right, ending just under the slot.
+			cv.RotatedText(text, rl.Vector2{
+				center - sin45*(size.X+size.Y/2),
+				top + sin45*size.X,
+			}, chartTextSize, -45, ink)
+		} else {
+			cv.Text(text, rl.Vector2{center - size.X/2, top}, chartTextSize, ink)
+		}
+	}
+
+	cv.Line(rl.Vector2{plot.X, plot.Y}, rl.Vector2{plot.X, plotBottom}, 1, ink)
+	cv.Line(rl.Vector2{plot.X, plotBottom}, rl.Vector2{plot.X + plot.Width, plotBottom}, 1, ink)
+
+	if x.Title != "" {
+		text := fitChartText(cv, x.Title, chartTextSize, plot.Width)
+		size := cv.MeasureText(text, chartTextSize)
+		cv.Text(text, rl.Vector2{
+			plot.X + plot.Width/2 - size.X/2,
+			bounds.Y + bounds.Height - size.Y,
+		}, chartTextSize, ink)
+	}
+	if y.Title != "" {
+		// Turned to read from bottom to top.
+		text := fitChartText(cv, y.Title, chartTextSize, plot.Height)
+		size := cv.MeasureText(text, chartTextSize)
+		cv.RotatedText(text, rl.Vector2{
+			bounds.X,
+			plot.Y + plot.Height/2 + size.X/2,
+		}, chartTextSize, -90, ink)
+	}
+}
+
+// chartMark Where a single value was drawn, so it can be found again under
+// the mouse.
+type chartMark struct {
+	Rect  rl.Rectangle // the area that counts as being over it
+	Point rl.Vector2   // where the value itself is; the closest mark wins
+
+	// Pie slices are sectors instead.
+	Center                   rl.Vector2
+	InnerRadius, OuterRadius float32
+	StartAngle, EndAngle     float32
+
+	Label   string
+	Series  string
+	Value   float64
+	Details []string // shown in place of the value, when one number isn't enough
+}
+
+func (m chartMark) Contains(p rl.Vector2) bool {
+	if m.OuterRadius > 0 {
+		dist := float32(math.Hypot(float64(p.X-m.Center.X), float64(p.Y-m.Center.Y)))
+		if dist < m.InnerRadius || dist > m.OuterRadius {
+			return false
+		}
+		angle := float32(math.Atan2(float64(p.Y-m.Center.Y), float64(p.X-m.Center.X)))
+		for angle < m.StartAngle {
+			angle += 2 * math.Pi
+		}
+		for angle >= m.StartAngle+2*math.Pi {
+			angle -= 2 * math.Pi
+		}
+		return angle < m.EndAngle
+	}
+	return m.Rect.X <= p.X && p.X < m.Rect.X+m.Rect.Width &&
+		m.Rect.Y <= p.Y && p.Y < m.Rect.Y+m.Rect.Height
+}
+
+// Finds the mark under p. Where marks overlap, the one whose value is closest
+// wins.
+func hoveredChartMark(marks []chartMark, p rl.Vector2) (chartMark, bool) {
+	var best chartMark
+	bestDist := math.Inf(1)
+	for _, m := range marks {
+		if !m.Contains(p) {
+			continue
+		}
+		if dist := math.Hypot(float64(p.X-m.Point.X), float64(p.Y-m.Point.Y)); dist < bestDist {
+			best, bestDist = m, dist
+		}
+	}
+	return best, !math.IsInf(bestDist, 1)
+}
+
+// drawChartTooltip Shows the exact label and value of a mark in a box next to
+// the mouse, kept inside bounds.
+func drawChartTooltip(cv chartCanvas, bounds rl.Rectangle, mark chartMark, mouse rl.Vector2, ink rl.Color) {
+	const offset = 16
+
+	value := strconv.FormatFloat(mark.Value, 'f', -1, 64)
+	if mark.Series != "" {
+		value = mark.Series + ": " + value
+	}
+	lines := []string{mark.Label, value}
+	if mark.Details != nil {
+		lines = append([]string{mark.Label}, mark.Details...)
+	}
+
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	box := rl.Rectangle{
+		mouse.X + offset,
+		mouse.Y + offset,
+		widestChartText(cv, lines) + 2*chartPadding,
+		float32(len(lines))*textHeight + 2*chartPadding,
+	}
+	if box.X+box.Width > bounds.X+bounds.Width {
+		box.X = mouse.X - offset - box.Width
+	}
+	if box.Y+box.Height > bounds.Y+bounds.Height {
+		box.Y = mouse.Y - offset - box.Height
+	}
+
+	cv.Rect(box, rl.NewColor(250, 250, 250, 240))
+	corners := []rl.Vector2{
+		{box.X, box.Y},
+		{box.X + box.Width, box.Y},
+		{box.X + box.Width, box.Y + box.Height},
+		{box.X, box.Y + box.Height},
+	}
+	for i := range corners {
+		cv.Line(corners[i], corners[(i+1)%len(corners)], 1, ink)
+	}
+	for i, line := range lines {
+		cv.Text(line, rl.Vector2{box.X + chartPadding, box.Y + chartPadding + float32(i)*textHeight}, chartTextSize, ink)
+	}
+}
+
+type chartLegendEntry struct {
+	Label string
+	Color rl.Color
+}
+
+func chartLegendWidth(cv chartCanvas, entries []chartLegendEntry) float32 {
+	var width float32
+	for _, entry := range entries {
+		width = float32(math.Max(float64(width), float64(cv.MeasureText(entry.Label, chartTextSize).X)))
+	}
+	swatch := cv.MeasureText("Ag", chartTextSize).Y
+	return swatch + chartPadding + width
+}
+
+// Lists entries top to bottom, centered vertically in bounds. If they don't
+// all fit, the last row says how many were left out.
+func drawChartLegend(cv chartCanvas, bounds rl.Rectangle, entries []chartLegendEntry, ink rl.Color) {
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	rowHeight := textHeight + chartPadding/2
+	swatch := textHeight * 0.7
+
+	maxRows := int(bounds.Height / rowHeight)
+	if maxRows <= 0 {
+		return
+	}
+	shown, hidden := entries, 0
+	if len(entries) > maxRows {
+		shown, hidden = entries[:maxRows-1], len(entries)-(maxRows-1)
+	}
+	rows := len(shown)
+	if hidden > 0 {
+		rows++
+	}
+
+	y := bounds.Y + (bounds.Height-float32(rows)*rowHeight)/2
+	textX := bounds.X + textHeight + chartPadding
+	for _, entry := range shown {
+		cv.Rect(rl.Rectangle{bounds.X + (textHeight-swatch)/2, y + (rowHeight-swatch)/2, swatch, swatch}, entry.Color)
+		text := fitChartText(cv, entry.Label, chartTextSize, bounds.X+bounds.Width-textX)
+		cv.Text(text, rl.Vector2{textX, y + (rowHeight-textHeight)/2}, chartTextSize, ink)
+		y += rowHeight
+	}
+	if hidden > 0 {
+		cv.Text(fmt.Sprintf("+%d more", hidden), rl.Vector2{textX, y + (rowHeight-textHeight)/2}, chartTextSize, ink)
+	}
+}
+
+// The color for one series. A lone series is drawn in ink.
+func seriesColor(data *chartData, i int, ink rl.Color) rl.Color {
+	if len(data.Series) == 1 {
+		return ink
+	}
+	return chartColor(i)
+}
+
+// Bar, line, and area charts: one slot per label along one axis, values along
+// the other.
+func drawCategoryChart(cv chartCanvas, bounds rl.Rectangle, typ ChartType, data *chartData, ink rl.Color) []chartMark {
+	horizontal := typ == HorizontalBarChart
+	stacked := data.Stacked && typ.CanStack()
+	rangeValues := allSeriesValues(data.Series)
+	if stacked {
+		rangeValues = stackedTotals(data.Series)
+	}
+	min, max := chartValueRange(rangeValues, typ != LineChart)
+
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	categoryAxis := newCategoryAxis(data.Labels, data.XTitle)
+	var valueAxis chartAxis
+	var plot rl.Rectangle
+	if horizontal {
+		valueAxis = newValueAxis(min, max, bounds.Width, valueLabelSize(cv, min, max), data.YTitle)
+		plot = layoutChartAxes(cv, bounds, &valueAxis, &categoryAxis)
+		drawChartAxes(cv, bounds, plot, valueAxis, categoryAxis, ink)
+	} else {
+		valueAxis = newValueAxis(min, max, bounds.Height, 2.5*textHeight, data.YTitle)
+		plot = layoutChartAxes(cv, bounds, &categoryAxis, &valueAxis)
+		drawChartAxes(cv, bounds, plot, categoryAxis, valueAxis, ink)
+	}
+
+	zero := valueAxis.Pos(0)
+	if valueAxis.Min < 0 && valueAxis.Max > 0 {
+		if horizontal {
+			cv.Line(rl.Vector2{zero, plot.Y}, rl.Vector2{zero, plot.Y + plot.Height}, 1, ink)
+		} else {
+			cv.Line(rl.Vector2{plot.X, zero}, rl.Vector2{plot.X + plot.Width, zero}, 1, ink)
+		}
+	}
+
+	slot := (categoryAxis.End - categoryAxis.Start) / float32(len(data.Labels))
+	const spacingBetweenGroups = 0.5 // times width of a group
+	groupWidth := slot / (1 + spacingBetweenGroups)
+
+	// Where the next stacked value starts, above and below zero.
+	stackUp := make([]float64, len(data.Labels))
+	stackDown := make([]float64, len(data.Labels))
+
+	var marks []chartMark
+	for si, s := range data.Series {
+		color := seriesColor(data, si, ink)
+
+		// Anywhere in a point's slot counts as hovering it.
+		addPointMarks := func(points []*rl.Vector2) {
+			for i, p := range points {
+				if p == nil || math.IsNaN(s.Values[i]) {
+					continue
+				}
+				marks = append(marks, chartMark{
+					Rect:   rl.Rectangle{p.X - slot/2, plot.Y, slot, plot.Height},
+					Point:  *p,
+					Label:  data.Labels[i],
+					Series: s.Name,
+					Value:  s.Values[i],
+				})
+			}
+		}
+
+		switch typ {
+		case BarChart, HorizontalBarChart:
+			barWidth := groupWidth / float32(len(data.Series))
+			if stacked {
+				barWidth = groupWidth
+			}
+			for i, v := range s.Values {
+				if math.IsNaN(v) {
+					continue
+				}
+				barStart := categoryAxis.Pos(float64(i)+0.5) - groupWidth/2
+				from := 0.0
+				if stacked {
+					if v >= 0 {
+						from, stackUp[i] = stackUp[i], stackUp[i]+v
+					} else {
+						from, stackDown[i] = stackDown[i], stackDown[i]+v
+					}
+				} else {
+					barStart += float32(si) * barWidth
+				}
+				bar := chartBarRect(barStart, barWidth, valueAxis.Pos(from), valueAxis.Pos(from+v), horizontal)
+				cv.Rect(bar, data.labelColor(data.Labels[i], color))
+				marks = append(marks, chartMark{
+					Rect:   growChartRect(bar, 6),
+					Point:  rl.Vector2{bar.X + bar.Width/2, bar.Y + bar.Height/2},
+					Label:  data.Labels[i],
+					Series: s.Name,
+					Value:  v,
+				})
+			}
+		case LineChart:
+			points := categoryPoints(s.Values, categoryAxis, valueAxis)
+			drawChartLine(cv, points, slot, color)
+			addPointMarks(points)
+		case AreaChart:
+			// Stacked areas sit on the running total, with gaps counted as
+			// zero so the layers don't fall apart.
+			values, bases := s.Values, make([]float64, len(s.Values))
+			if stacked {
+				values = make([]float64, len(s.Values))
+				for i, v := range s.Values {
+					if math.IsNaN(v) {
+						v = 0
+					}
+					bases[i] = stackUp[i]
+					values[i] = stackUp[i] + v
+					stackUp[i] = values[i]
+				}
+			}
+
+			points := categoryPoints(values, categoryAxis, valueAxis)
+			basePoints := categoryPoints(bases, categoryAxis, valueAxis)
+			fill := withAlpha(color, 0.4)
+			for i := 1; i < len(points); i++ {
+				if points[i-1] != nil && points[i] != nil {
+					drawBandSegment(cv, *points[i-1], *points[i], *basePoints[i-1], *basePoints[i], fill)
+				}
+			}
+			drawChartLine(cv, points, slot, color)
+			addPointMarks(points)
+		}
+	}
+
+	return marks
+}
+
+// Grows a rectangle around its center until it is at least minSize each way,
+// so that thin bars can still be pointed at.
+func growChartRect(r rl.Rectangle, minSize float32) rl.Rectangle {
+	if r.Width < minSize {
+		r.X -= (minSize - r.Width) / 2
+		r.Width = minSize
+	}
+	if r.Height < minSize {
+		r.Y -= (minSize - r.Height) / 2
+		r.Height = minSize
+	}
+	return r
+}
+
+// A rectangle spanning from one value position to another, across a
+// category position.
+func chartBarRect(catStart, catWidth, valFrom, valTo float32, horizontal bool) rl.Rectangle {
+	lo := float32(math.Min(float64(valFrom), float64(valTo)))
+	hi := float32(math.Max(float64(valFrom), float64(valTo)))
+	if horizontal {
+		return rl.Rectangle{lo, catStart, hi - lo, catWidth}
+	}
+	return rl.Rectangle{catStart, lo, catWidth, hi - lo}
+}
+
+// The screen position of each value at the center of its slot, or nil for
+// missing values.
+func categoryPoints(values []float64, categoryAxis, valueAxis chartAxis) []*rl.Vector2 {
+	points := make([]*rl.Vector2, len(values))
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		points[i] = &rl.Vector2{categoryAxis.Pos(float64(i) + 0.5), valueAxis.Pos(v)}
+	}
+	return points
+}
+
+// Connects consecutive points, leaving gaps at missing ones. Points get dots
+// when there is room for them, or when nothing connects to them.
+func drawChartLine(cv chartCanvas, points []*rl.Vector2, slot float32, color rl.Color) {
+	for i, p := range points {
+		if p == nil {
+			continue
+		}
+		connectedBefore := i > 0 && points[i-1] != nil
+		connectedAfter := i+1 < len(points) && points[i+1] != nil
+		if connectedAfter {
+			cv.Line(*p, *points[i+1], 3, color)
+		}
+		if slot >= 16 || !connectedBefore && !connectedAfter {
+			cv.Circle(*p, 4, color)
+		}
+	}
+}
+
+// Fills the band between two line segments, a and b on top and aBase and
+// bBase underneath. Bands that cross over are split so every piece stays
+// convex.
+func drawBandSegment(cv chartCanvas, a, b, aBase, bBase rl.Vector2, color rl.Color) {
+	da, db := a.Y-aBase.Y, b.Y-bBase.Y
+	if da*db < 0 {
+		t := da / (da - db)
+		cross := rl.Vector2{a.X + t*(b.X-a.X), a.Y + t*(b.Y-a.Y)}
+		cv.Polygon([]rl.Vector2{aBase, a, cross}, color)
+		cv.Polygon([]rl.Vector2{cross, b, bBase}, color)
+		return
+	}
+	cv.Polygon([]rl.Vector2{aBase, a, b, bBase}, color)
+}
+
+// Plots each series against the x values, with value axes on both sides.
+func drawScatterChart(cv chartCanvas, bounds rl.Rectangle, data *chartData, ink rl.Color) []chartMark {
+	const radius = 5
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+
+	xMin, xMax := chartValueRange(data.XValues, false)
+	yMin, yMax := chartValueRange(allSeriesValues(data.Series), false)
+	xAxis := newValueAxis(xMin, xMax, bounds.Width, valueLabelSize(cv, xMin, xMax), data.XTitle)
+	yAxis := newValueAxis(yMin, yMax, bounds.Height, 2.5*textHeight, data.YTitle)
+
+	plot := layoutChartAxes(cv, bounds, &xAxis, &yAxis)
+	drawChartAxes(cv, bounds, plot, xAxis, yAxis, ink)
+
+	var marks []chartMark
+	for si, s := range data.Series {
+		color := withAlpha(seriesColor(data, si, ink), 0.7)
+		for i, y := range s.Values {
+			if i >= len(data.XValues) || math.IsNaN(y) || math.IsNaN(data.XValues[i]) {
+				continue
+			}
+			x := data.XValues[i]
+			p := rl.Vector2{xAxis.Pos(x), yAxis.Pos(y)}
+			cv.Circle(p, radius, color)
+			marks = append(marks, chartMark{
+				Rect:   rl.Rectangle{p.X - 2*radius, p.Y - 2*radius, 4 * radius, 4 * radius},
+				Point:  p,
+				Label:  data.XTitle + ": " + strconv.FormatFloat(x, 'f', -1, 64),
+				Series: s.Name,
+				Value:  y,
+			})
+		}
+	}
+
+	return marks
+}
+
+// Draws the first series as slices of a pie, with a legend on the right.
+// Slices only make sense for positive values, so the rest are left out.
+// Other series are ignored; split pies wouldn't be readable anyway.
+func drawPieChart(cv chartCanvas, bounds rl.Rectangle, data *chartData, donut bool, ink rl.Color) []chartMark {
+	values := data.Series[0].Values
+
+	var total float64
+	for _, v := range values {
+		if v > 0 {
+			total += v
+		}
+	}
+	if total == 0 {
+		drawChartMessage(cv, bounds, "No positive values", ink)
+		return nil
+	}
+
+	var entries []chartLegendEntry
+	for i, v := range values {
+		if v > 0 {
+			entries = append(entries, chartLegendEntry{
+				Label: fmt.Sprintf("%s (%.0f%%)", data.Labels[i], v/total*100),
+				Color: chartColor(len(entries)),
+			})
+		}
+	}
+
+	legendWidth := float32(math.Min(float64(chartLegendWidth(cv, entries)), float64(bounds.Width*0.4)))
+	drawChartLegend(cv, rl.Rectangle{
+		bounds.X + bounds.Width - legendWidth,
+		bounds.Y,
+		legendWidth,
+		bounds.Height,
+	}, entries, ink)
+
+	pieBounds := bounds
+	pieBounds.Width -= legendWidth + chartPadding
+	center := rl.Vector2{pieBounds.X + pieBounds.Width/2, pieBounds.Y + pieBounds.Height/2}
+	radius := float32(math.Min(float64(pieBounds.Width), float64(pieBounds.Height)))/2 - chartPadding
+	if radius <= 0 {
+		return nil
+	}
+	var innerRadius float32
+	if donut {
+		innerRadius = radius * 0.55
+	}
+
+	angle := float32(-math.Pi / 2) // start at 12 o'clock
+	var marks []chartMark
+	for i, v := range values {
+		if !(v > 0) { // also skips NaNs
+			continue
+		}
+		sweep := float32(v / total * 2 * math.Pi)
+		cv.Sector(center, innerRadius, radius, angle, angle+sweep, data.labelColor(data.Labels[i], chartColor(len(marks))))
+		marks = append(marks, chartMark{
+			Point:       center,
+			Center:      center,
+			InnerRadius: innerRadius,
+			OuterRadius: radius,
+			StartAngle:  angle,
+			EndAngle:    angle + sweep,
+			Label:       data.Labels[i],
+			Series:      data.Series[0].Name,
+			Value:       v,
+		})
+		angle += sweep
+	}
+
+	if donut {
+		label := formatChartValue(total)
+		size := cv.MeasureText(label, chartTextSize)
+		if size.X < innerRadius*2 {
+			cv.Text(label, rl.Vector2{center.X - size.X/2, center.Y - size.Y/2}, chartTextSize, ink)
+		}
+	}
+
+	return marks
+}
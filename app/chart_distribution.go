@@ -0,0 +1,257 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type DistributionKind int
+
+const (
+	Histogram DistributionKind = iota
+	BoxPlot
+)
+
+// distributionData How the values of one column are spread out, overall and
+// for each group when the values are split by another column.
+type distributionData struct {
+	Groups []distributionGroup
+
+	// Every group is counted into the same bins.
+	BinStart float64
+	BinWidth float64
+	NumBins  int
+
+	Title      string // the column the values came from
+	SplitTitle string // the column they were split by, if any
+}
+
+type distributionGroup struct {
+	Name  string
+	Count int
+
+	Min, Q1, Median, Q3, Max float64
+	// The furthest values within 1.5 IQRs of the box. Anything past them is
+	// an outlier.
+	WhiskerLow, WhiskerHigh float64
+	Outliers                []float64
+
+	Bins []int // the number of values in each bin
+}
+
+const maxHistogramBins = 200
+
+// histogramBins Picks bins covering lo to hi. With a fixed count, the range
+// is split evenly. Otherwise the bin width comes from the Freedman–Diaconis
+// rule, rounded to a nice number, with Sturges' rule filling in when the
+// middle half of the values are all the same.
+func histogramBins(count int, lo, hi, q1, q3 float64, fixed int) (start, width float64, num int) {
+	if count == 0 || hi <= lo {
+		return lo - 0.5, 1, 1
+	}
+
+	if fixed > 0 {
+		if fixed > maxHistogramBins {
+			fixed = maxHistogramBins
+		}
+		return lo, (hi - lo) / float64(fixed), fixed
+	}
+
+	raw := 2 * (q3 - q1) / math.Cbrt(float64(count))
+	if !(raw > 0) {
+		raw = (hi - lo) / (math.Ceil(math.Log2(float64(count))) + 1)
+	}
+	raw = math.Max(raw, (hi-lo)/maxHistogramBins)
+
+	width = niceStep(raw)
+	start = math.Floor(lo/width) * width
+	num = int(math.Ceil((hi - start) / width))
+	if num < 1 {
+		num = 1
+	}
+	return start, width, num
+}
+
+// binEdgeLabel Formats a bin edge without the float noise that comes from
+// adding up bin widths.
+func binEdgeLabel(v float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 10, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+func (d *distributionData) groupName(g distributionGroup) string {
+	if g.Name == "" && len(d.Groups) == 1 {
+		return d.Title
+	}
+	return g.Name
+}
+
+func (d *distributionData) groupColor(i int, ink rl.Color) rl.Color {
+	if len(d.Groups) == 1 {
+		return ink
+	}
+	return chartColor(i)
+}
+
+func drawDistribution(cv chartCanvas, bounds rl.Rectangle, kind DistributionKind, data *distributionData, ink rl.Color) []chartMark {
+	if len(data.Groups) == 0 {
+		drawChartMessage(cv, bounds, "No numbers", ink)
+		return nil
+	}
+
+	switch kind {
+	case BoxPlot:
+		return drawBoxPlot(cv, bounds, data, ink)
+	default:
+		return drawHistogram(cv, bounds, data, ink)
+	}
+}
+
+// Draws one bar per bin, with each group's count stacked on top of the last.
+func drawHistogram(cv chartCanvas, bounds rl.Rectangle, data *distributionData, ink rl.Color) []chartMark {
+	if len(data.Groups) > 1 {
+		names := make([]string, len(data.Groups))
+		for i, g := range data.Groups {
+			names[i] = g.Name
+		}
+		bounds = drawSeriesLegend(cv, bounds, names, ink)
+	}
+
+	totals := make([]float64, data.NumBins)
+	for _, g := range data.Groups {
+		for bin, count := range g.Bins {
+			totals[bin] += float64(count)
+		}
+	}
+
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	lo := data.BinStart
+	hi := data.BinStart + float64(data.NumBins)*data.BinWidth
+	xAxis := newValueAxis(lo, hi, bounds.Width, valueLabelSize(cv, lo, hi), data.Title)
+	yMin, yMax := chartValueRange(totals, true)
+	yAxis := newValueAxis(yMin, yMax, bounds.Height, 2.5*textHeight, "Count")
+
+	plot := layoutChartAxes(cv, bounds, &xAxis, &yAxis)
+	drawChartAxes(cv, bounds, plot, xAxis, yAxis, ink)
+
+	var marks []chartMark
+	stack := make([]int, data.NumBins)
+	for gi, g := range data.Groups {
+		color := data.groupColor(gi, ink)
+		for bin, count := range g.Bins {
+			if count == 0 {
+				continue
+			}
+
+			binLo := data.BinStart + float64(bin)*data.BinWidth
+			binHi := binLo + data.BinWidth
+			left, right := xAxis.Pos(binLo), xAxis.Pos(binHi)
+			if right-left > 3 {
+				right-- // a gap so neighboring bars don't run together
+			}
+			bar := chartBarRect(left, right-left, yAxis.Pos(float64(stack[bin])), yAxis.Pos(float64(stack[bin]+count)), false)
+			stack[bin] += count
+			cv.Rect(bar, color)
+
+			// Bins include their low edge, and only the last one includes
+			// its high edge.
+			closing := ")"
+			if bin == data.NumBins-1 {
+				closing = "]"
+			}
+			series := ""
+			if len(data.Groups) > 1 {
+				series = g.Name
+			}
+			marks = append(marks, chartMark{
+				Rect:   growChartRect(bar, 6),
+				Point:  rl.Vector2{bar.X + bar.Width/2, bar.Y + bar.Height/2},
+				Label:  fmt.Sprintf("[%s, %s%s", binEdgeLabel(binLo), binEdgeLabel(binHi), closing),
+				Series: series,
+				Value:  float64(count),
+			})
+		}
+	}
+
+	return marks
+}
+
+// Draws a box from the first to the third quartile for each group, with a
+// line at the median, whiskers out to the furthest values that aren't
+// outliers, and a dot for each outlier.
+func drawBoxPlot(cv chartCanvas, bounds rl.Rectangle, data *distributionData, ink rl.Color) []chartMark {
+	const outlierRadius = 3
+
+	labels := make([]string, len(data.Groups))
+	var values []float64
+	for i, g := range data.Groups {
+		labels[i] = data.groupName(g)
+		values = append(values, g.Min, g.Max)
+	}
+
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	min, max := chartValueRange(values, false)
+	xAxis := newCategoryAxis(labels, data.SplitTitle)
+	yAxis := newValueAxis(min, max, bounds.Height, 2.5*textHeight, data.Title)
+
+	plot := layoutChartAxes(cv, bounds, &xAxis, &yAxis)
+	drawChartAxes(cv, bounds, plot, xAxis, yAxis, ink)
+
+	slot := (xAxis.End - xAxis.Start) / float32(len(data.Groups))
+	boxWidth := float32(math.Min(float64(slot/2), 120))
+
+	var marks []chartMark
+	for i, g := range data.Groups {
+		color := data.groupColor(i, ink)
+		center := xAxis.Pos(float64(i) + 0.5)
+		left, right := center-boxWidth/2, center+boxWidth/2
+		q1, median, q3 := yAxis.Pos(g.Q1), yAxis.Pos(g.Median), yAxis.Pos(g.Q3)
+		low, high := yAxis.Pos(g.WhiskerLow), yAxis.Pos(g.WhiskerHigh)
+
+		// whiskers
+		cv.Line(rl.Vector2{center, q1}, rl.Vector2{center, low}, 1, color)
+		cv.Line(rl.Vector2{center, q3}, rl.Vector2{center, high}, 1, color)
+		cv.Line(rl.Vector2{center - boxWidth/4, low}, rl.Vector2{center + boxWidth/4, low}, 1, color)
+		cv.Line(rl.Vector2{center - boxWidth/4, high}, rl.Vector2{center + boxWidth/4, high}, 1, color)
+
+		// box
+		box := chartBarRect(left, boxWidth, q1, q3, false)
+		cv.Rect(box, withAlpha(color, 0.3))
+		corners := []rl.Vector2{{left, q3}, {right, q3}, {right, q1}, {left, q1}}
+		for ci := range corners {
+			cv.Line(corners[ci], corners[(ci+1)%len(corners)], 1, color)
+		}
+		cv.Line(rl.Vector2{left, median}, rl.Vector2{right, median}, 3, color)
+
+		marks = append(marks, chartMark{
+			Rect:  rl.Rectangle{center - slot/2, plot.Y, slot, plot.Height},
+			Point: rl.Vector2{center, median},
+			Label: labels[i],
+			Details: []string{
+				fmt.Sprintf("count: %d", g.Count),
+				"min: " + strconv.FormatFloat(g.Min, 'f', -1, 64),
+				"Q1: " + strconv.FormatFloat(g.Q1, 'f', -1, 64),
+				"median: " + strconv.FormatFloat(g.Median, 'f', -1, 64),
+				"Q3: " + strconv.FormatFloat(g.Q3, 'f', -1, 64),
+				"max: " + strconv.FormatFloat(g.Max, 'f', -1, 64),
+			},
+		})
+
+		for _, v := range g.Outliers {
+			p := rl.Vector2{center, yAxis.Pos(v)}
+			cv.Circle(p, outlierRadius, withAlpha(color, 0.6))
+			marks = append(marks, chartMark{
+				Rect:   rl.Rectangle{p.X - 3*outlierRadius, p.Y - 3*outlierRadius, 6 * outlierRadius, 6 * outlierRadius},
+				Point:  p,
+				Label:  labels[i],
+				Series: "outlier",
+				Value:  v,
+			})
+		}
+	}
+
+	return marks
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Exported charts are laid out at this size no matter the resolution, so text
+// stays the same size relative to the chart. PNGs are scaled up from it.
+const chartExportWidth = 1280
+const chartExportHeight = 720
+const chartExportMargin = 24
+
+type chartResolution struct {
+	Width, Height int
+}
+
+var chartResolutionOpts = []raygui.DropdownExOption{
+	{"1280x720", chartResolution{1280, 720}},
+	{"1920x1080", chartResolution{1920, 1080}},
+	{"2560x1440", chartResolution{2560, 1440}},
+	{"3840x2160", chartResolution{3840, 2160}},
+}
+
+func chartExportBounds(width, height float32) rl.Rectangle {
+	return rl.Rectangle{
+		chartExportMargin,
+		chartExportMargin,
+		width - 2*chartExportMargin,
+		height - 2*chartExportMargin,
+	}
+}
+
+// Swaps whatever extension the path has for ext.
+func chartExportPath(path string, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// exportChartPNG Renders a chart offscreen and saves it. This has to happen
+// outside of the canvas camera, so nodes call it from Update instead of
+// right when the button is clicked.
+func exportChartPNG(path string, res chartResolution, typ ChartType, data *chartData, ink rl.Color) error {
+	target := rl.LoadRenderTexture(int32(res.Width), int32(res.Height))
+	defer rl.UnloadRenderTexture(target)
+
+	rl.BeginTextureMode(target)
+	rl.ClearBackground(rl.White)
+	rl.BeginMode2D(rl.Camera2D{Zoom: float32(res.Width) / chartExportWidth})
+	drawChart(rlChartCanvas{}, chartExportBounds(chartExportWidth, chartExportHeight), typ, data, ink)
+	rl.EndMode2D()
+	rl.EndTextureMode()
+
+	// Render textures come back upside down.
+	img := rl.GetTextureData(target.Texture)
+	defer rl.UnloadImage(img)
+	rl.ImageFlipVertical(img)
+
+	// raylib doesn't say whether the export worked, so check for the file.
+	os.Remove(path)
+	rl.ExportImage(*img, path)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("couldn't write %s", path)
+	}
+	return nil
+}
+
+func exportChartSVG(path string, typ ChartType, data *chartData, ink rl.Color) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeChartSVG(f, chartExportWidth, chartExportHeight, typ, data, ink); err != nil {
+		return err
+	}
+	return f.Close()
+}
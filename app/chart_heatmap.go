@@ -0,0 +1,160 @@
+package app
+
+import (
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Heatmaps fade from almost white to blue, or to red for negative values.
+var heatmapLow = rl.NewColor(247, 251, 255, 255)
+var heatmapHigh = rl.NewColor(8, 81, 156, 255)
+var heatmapNegative = rl.NewColor(165, 15, 21, 255)
+
+func lerpColor(a, b rl.Color, t float32) rl.Color {
+	t = Clamp(t, 0, 1)
+	return rl.NewColor(
+		uint8(Lerp(float32(a.R), float32(b.R), t)),
+		uint8(Lerp(float32(a.G), float32(b.G), t)),
+		uint8(Lerp(float32(a.B), float32(b.B), t)),
+		uint8(Lerp(float32(a.A), float32(b.A), t)),
+	)
+}
+
+// heatmapColor Picks the color for a value on a scale from min to max. When
+// the scale crosses zero, zero stays white and each side gets its own color.
+func heatmapColor(v, min, max float64) rl.Color {
+	switch {
+	case min < 0 && max > 0:
+		if v < 0 {
+			return lerpColor(heatmapLow, heatmapNegative, float32(v/min))
+		}
+		return lerpColor(heatmapLow, heatmapHigh, float32(v/max))
+	case max <= 0:
+		return lerpColor(heatmapLow, heatmapNegative, float32((max-v)/(max-min)))
+	default:
+		return lerpColor(heatmapLow, heatmapHigh, float32((v-min)/(max-min)))
+	}
+}
+
+// Whether text on a color should be light instead of dark.
+func isDarkColor(c rl.Color) bool {
+	luminance := 0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)
+	return luminance < 140
+}
+
+// Draws the labels along the top and one row per series, with each cell
+// colored by its value. Cells are labeled with their values when there is
+// room.
+func drawHeatmap(cv chartCanvas, bounds rl.Rectangle, data *chartData, ink rl.Color) []chartMark {
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	min, max := chartValueRange(allSeriesValues(data.Series), false)
+	scale := newValueAxis(min, max, bounds.Height, 2.5*textHeight, data.ValueTitle)
+	bounds = drawHeatmapScale(cv, bounds, &scale, ink)
+
+	rows := make([]string, len(data.Series))
+	for i, s := range data.Series {
+		rows[i] = s.Name
+	}
+	xAxis := newCategoryAxis(data.Labels, data.XTitle)
+	yAxis := newCategoryAxis(rows, data.YTitle)
+	plot := layoutChartAxes(cv, bounds, &xAxis, &yAxis)
+
+	cellWidth := plot.Width / float32(len(data.Labels))
+	cellHeight := plot.Height / float32(len(data.Series))
+	var gap float32
+	if cellWidth > 6 && cellHeight > 6 {
+		gap = 1
+	}
+
+	var marks []chartMark
+	for si, s := range data.Series {
+		for i, v := range s.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+
+			cell := rl.Rectangle{
+				xAxis.Pos(float64(i)) + gap,
+				yAxis.Pos(float64(si)) + gap,
+				cellWidth - 2*gap,
+				cellHeight - 2*gap,
+			}
+			color := heatmapColor(v, scale.Min, scale.Max)
+			cv.Rect(cell, color)
+
+			label := formatChartValue(v)
+			size := cv.MeasureText(label, chartTextSize)
+			if size.X <= cell.Width-chartPadding && size.Y <= cell.Height {
+				textColor := ink
+				if isDarkColor(color) {
+					textColor = rl.White
+				}
+				cv.Text(label, rl.Vector2{
+					cell.X + cell.Width/2 - size.X/2,
+					cell.Y + cell.Height/2 - size.Y/2,
+				}, chartTextSize, textColor)
+			}
+
+			marks = append(marks, chartMark{
+				Rect:   cell,
+				Point:  rl.Vector2{cell.X + cell.Width/2, cell.Y + cell.Height/2},
+				Label:  data.Labels[i],
+				Series: s.Name,
+				Value:  v,
+			})
+		}
+	}
+
+	// The axes go on top so the cells don't cover them.
+	drawChartAxes(cv, bounds, plot, xAxis, yAxis, ink)
+
+	return marks
+}
+
+// drawHeatmapScale Draws the color scale down the right side of bounds, with
+// ticks along it and its title turned alongside. Returns what's left of
+// bounds for the heatmap itself.
+func drawHeatmapScale(cv chartCanvas, bounds rl.Rectangle, scale *chartAxis, ink rl.Color) rl.Rectangle {
+	const barWidth = 16
+	const steps = 32
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+
+	var labels []string
+	for _, tick := range scale.Ticks() {
+		labels = append(labels, scale.FormatTick(tick))
+	}
+	labelWidth := widestChartText(cv, labels)
+	width := barWidth + chartPadding + labelWidth
+	if scale.Title != "" {
+		width += chartPadding + textHeight
+	}
+
+	x := bounds.X + bounds.Width - width
+	scale.Start, scale.End = bounds.Y+bounds.Height-textHeight/2, bounds.Y+textHeight/2
+
+	for i := 0; i < steps; i++ {
+		lo := scale.Min + (scale.Max-scale.Min)*float64(i)/steps
+		hi := scale.Min + (scale.Max-scale.Min)*float64(i+1)/steps
+		top, bottom := scale.Pos(hi), scale.Pos(lo)
+		cv.Rect(rl.Rectangle{x, top, barWidth, bottom - top}, heatmapColor((lo+hi)/2, scale.Min, scale.Max))
+	}
+	for i, tick := range scale.Ticks() {
+		pos := scale.Pos(tick)
+		cv.Line(rl.Vector2{x + barWidth - 4, pos}, rl.Vector2{x + barWidth, pos}, 1, ink)
+		cv.Text(labels[i], rl.Vector2{x + barWidth + chartPadding, pos - textHeight/2}, chartTextSize, ink)
+	}
+
+	if scale.Title != "" {
+		// Turned to read from bottom to top, like a y axis title.
+		text := fitChartText(cv, scale.Title, chartTextSize, scale.Start-scale.End)
+		size := cv.MeasureText(text, chartTextSize)
+		cv.RotatedText(text, rl.Vector2{
+			x + barWidth + chartPadding + labelWidth + chartPadding,
+			(scale.Start+scale.End)/2 + size.X/2,
+		}, chartTextSize, -90, ink)
+	}
+
+	bounds.Width -= width + 2*chartPadding
+	return bounds
+}
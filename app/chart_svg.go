@@ -0,0 +1,146 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// svgChartCanvas Draws charts as SVG elements instead of pixels. It never
+// calls into raylib, so charts can be exported without a window.
+type svgChartCanvas struct {
+	sb strings.Builder
+}
+
+var _ chartCanvas = &svgChartCanvas{}
+
+// JetBrains Mono, the font we draw with everywhere else, is monospaced with
+// every glyph 0.6 em wide.
+const svgFontFamily = "JetBrains Mono, monospace"
+const svgGlyphWidth = 0.6
+
+// Roughly where raylib puts the baseline, as a fraction of the font size
+// down from the top of the text.
+const svgBaseline = 0.8
+
+func (c *svgChartCanvas) Rect(r rl.Rectangle, color rl.Color) {
+	fmt.Fprintf(&c.sb, `<rect x="%s" y="%s" width="%s" height="%s"%s/>`+"\n",
+		svgNum(r.X), svgNum(r.Y), svgNum(r.Width), svgNum(r.Height), svgFill(color))
+}
+
+func (c *svgChartCanvas) Line(start, end rl.Vector2, thick float32, color rl.Color) {
+	fmt.Fprintf(&c.sb, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke-width="%s"%s/>`+"\n",
+		svgNum(start.X), svgNum(start.Y), svgNum(end.X), svgNum(end.Y), svgNum(thick), svgStroke(color))
+}
+
+func (c *svgChartCanvas) Circle(center rl.Vector2, radius float32, color rl.Color) {
+	fmt.Fprintf(&c.sb, `<circle cx="%s" cy="%s" r="%s"%s/>`+"\n",
+		svgNum(center.X), svgNum(center.Y), svgNum(radius), svgFill(color))
+}
+
+func (c *svgChartCanvas) Polygon(points []rl.Vector2, color rl.Color) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = svgNum(p.X) + "," + svgNum(p.Y)
+	}
+	fmt.Fprintf(&c.sb, `<polygon points="%s"%s/>`+"\n", strings.Join(coords, " "), svgFill(color))
+}
+
+func (c *svgChartCanvas) Sector(center rl.Vector2, innerRadius, outerRadius, startAngle, endAngle float32, color rl.Color) {
+	// A single arc can't go all the way around, so whole circles are done in
+	// two halves.
+	if endAngle-startAngle >= 2*math.Pi-1e-4 {
+		mid := startAngle + math.Pi
+		c.Sector(center, innerRadius, outerRadius, startAngle, mid, color)
+		c.Sector(center, innerRadius, outerRadius, mid, startAngle+2*math.Pi, color)
+		return
+	}
+
+	largeArc := 0
+	if endAngle-startAngle > math.Pi {
+		largeArc = 1
+	}
+	point := func(radius, angle float32) string {
+		p := pointOnCircle(center, radius, angle)
+		return svgNum(p.X) + " " + svgNum(p.Y)
+	}
+
+	var d strings.Builder
+	fmt.Fprintf(&d, "M %s A %s %s 0 %d 1 %s ",
+		point(outerRadius, startAngle), svgNum(outerRadius), svgNum(outerRadius), largeArc, point(outerRadius, endAngle))
+	if innerRadius > 0 {
+		fmt.Fprintf(&d, "L %s A %s %s 0 %d 0 %s Z",
+			point(innerRadius, endAngle), svgNum(innerRadius), svgNum(innerRadius), largeArc, point(innerRadius, startAngle))
+	} else {
+		fmt.Fprintf(&d, "L %s Z", svgNum(center.X)+" "+svgNum(center.Y))
+	}
+	fmt.Fprintf(&c.sb, `<path d="%s"%s/>`+"\n", d.String(), svgFill(color))
+}
+
+func (c *svgChartCanvas) Text(text string, pos rl.Vector2, size float32, color rl.Color) {
+	c.RotatedText(text, pos, size, 0, color)
+}
+
+func (c *svgChartCanvas) RotatedText(text string, pos rl.Vector2, size float32, degrees float32, color rl.Color) {
+	fontSize := size * zoomLevel
+	var transform string
+	if degrees != 0 {
+		transform = fmt.Sprintf(` transform="rotate(%s %s %s)"`, svgNum(degrees), svgNum(pos.X), svgNum(pos.Y))
+	}
+	fmt.Fprintf(&c.sb, `<text x="%s" y="%s" font-size="%s"%s%s>%s</text>`+"\n",
+		svgNum(pos.X), svgNum(pos.Y+svgBaseline*fontSize), svgNum(fontSize), transform, svgFill(color), html.EscapeString(text))
+}
+
+func (c *svgChartCanvas) MeasureText(text string, size float32) rl.Vector2 {
+	fontSize := size * zoomLevel
+	return rl.Vector2{
+		X: float32(len([]rune(text))) * svgGlyphWidth * fontSize,
+		Y: fontSize,
+	}
+}
+
+// Two decimals is plenty for screen coordinates, and keeps the output
+// stable from run to run.
+func svgNum(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 2, 32)
+}
+
+func svgColor(color rl.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", color.R, color.G, color.B)
+}
+
+func svgFill(color rl.Color) string {
+	res := fmt.Sprintf(` fill="%s"`, svgColor(color))
+	if color.A < 255 {
+		res += fmt.Sprintf(` fill-opacity="%.2f"`, float32(color.A)/255)
+	}
+	return res
+}
+
+func svgStroke(color rl.Color) string {
+	res := fmt.Sprintf(` stroke="%s"`, svgColor(color))
+	if color.A < 255 {
+		res += fmt.Sprintf(` stroke-opacity="%.2f"`, float32(color.A)/255)
+	}
+	return res
+}
+
+// writeChartSVG Writes a whole SVG document of a chart, on a white
+// background. It doesn't need a window, and the same data always produces
+// the same file, so exports can be checked by comparing files.
+func writeChartSVG(w io.Writer, width, height float32, typ ChartType, data *chartData, ink rl.Color) error {
+	var cv svgChartCanvas
+	drawChart(&cv, chartExportBounds(width, height), typ, data, ink)
+
+	_, err := fmt.Fprintf(w,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="%s">`+"\n"+
+			`<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n"+
+			"%s</svg>\n",
+		svgNum(width), svgNum(height), svgNum(width), svgNum(height), svgFontFamily, cv.sb.String())
+	return err
+}
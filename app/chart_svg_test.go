@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The same films-by-rating numbers for every chart type, so the golden files
+// can be compared with each other too.
+func svgTestData(typ ChartType) *chartData {
+	data := &chartData{
+		Labels: []string{"G", "PG", "PG-13", "R", "NC-17"},
+		Series: []chartSeries{
+			{Name: "films", Values: []float64{178, 194, 223, 195, 210}},
+			{Name: "rentals", Values: []float64{2773, 3212, 3585, 3181, 3293}},
+		},
+		XTitle:     "rating",
+		YTitle:     "count",
+		ValueTitle: "count",
+	}
+	if typ == ScatterChart {
+		data.Labels = nil
+		data.XValues = []float64{0.99, 2.99, 4.99, 1.99, 3.99}
+		data.XTitle = "rental_rate"
+	}
+	return data
+}
+
+func svgTestTimeData() *chartData {
+	data := &chartData{
+		Labels: []string{"2005-05-01", "2005-06-01", "2005-08-01", "2005-09-01"},
+		Series: []chartSeries{{Name: "rentals", Values: []float64{1156, 2311, 5686, 182}}},
+		XTitle: "month",
+		YTitle: "rentals",
+	}
+	for _, label := range data.Labels {
+		t, _ := parseChartTime(label)
+		data.Times = append(data.Times, float64(t.Unix()))
+	}
+	fillTimeGaps(data)
+	data.TimeView = &chartTimeView{}
+	return data
+}
+
+func TestWriteChartSVG(t *testing.T) {
+	type chartCase struct {
+		name string
+		typ  ChartType
+		data *chartData
+	}
+	var cases []chartCase
+	for _, opt := range chartTypeOpts {
+		typ := opt.Value.(ChartType)
+		name := strings.ReplaceAll(strings.ToLower(opt.Name), " ", "_")
+		cases = append(cases, chartCase{name, typ, svgTestData(typ)})
+	}
+	cases = append(cases, chartCase{"line_time", LineChart, svgTestTimeData()})
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeChartSVG(&buf, chartExportWidth, chartExportHeight, c.typ, c.data, rl.Black); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "chart_"+c.name+".svg")
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output doesn't match %s (run with -update if the change is intended)", golden)
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package app
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Time axes run in Unix seconds, and are ticked on whole calendar units.
+
+type timeUnit int
+
+const (
+	timeHour timeUnit = iota
+	timeDay
+	timeWeek
+	timeMonth
+	timeYear
+)
+
+type timeStep struct {
+	Unit  timeUnit
+	Count int
+}
+
+// The steps a time axis can tick at, smallest first.
+var timeSteps = []timeStep{
+	{timeHour, 1}, {timeHour, 3}, {timeHour, 6}, {timeHour, 12},
+	{timeDay, 1}, {timeDay, 2},
+	{timeWeek, 1}, {timeWeek, 2},
+	{timeMonth, 1}, {timeMonth, 3}, {timeMonth, 6},
+	{timeYear, 1}, {timeYear, 2}, {timeYear, 5}, {timeYear, 10}, {timeYear, 25}, {timeYear, 50}, {timeYear, 100},
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// Seconds Gets roughly how long a step is. Months and years vary.
+func (s timeStep) Seconds() float64 {
+	var unit float64
+	switch s.Unit {
+	case timeHour:
+		unit = 60 * 60
+	case timeDay:
+		unit = secondsPerDay
+	case timeWeek:
+		unit = 7 * secondsPerDay
+	case timeMonth:
+		unit = 30.44 * secondsPerDay
+	default:
+		unit = 365.25 * secondsPerDay
+	}
+	return unit * float64(s.Count)
+}
+
+// Floor Gets the tick at or before t. Ticks of more than one unit line up
+// with round numbers, like every third month starting in January.
+func (s timeStep) Floor(t time.Time) time.Time {
+	t = t.UTC()
+	days := int(math.Floor(float64(t.Unix()) / secondsPerDay))
+	switch s.Unit {
+	case timeHour:
+		hours := int(math.Floor(float64(t.Unix()) / (60 * 60)))
+		return time.Unix(int64(hours-positiveMod(hours, s.Count))*60*60, 0).UTC()
+	case timeDay:
+		return time.Unix(int64(days-positiveMod(days, s.Count))*secondsPerDay, 0).UTC()
+	case timeWeek:
+		// Weeks start on Monday, and January 5, 1970 was one.
+		weeks := int(math.Floor(float64(days-4) / 7))
+		weeks -= positiveMod(weeks, s.Count)
+		return time.Unix(int64(weeks*7+4)*secondsPerDay, 0).UTC()
+	case timeMonth:
+		months := t.Year()*12 + int(t.Month()) - 1
+		months -= positiveMod(months, s.Count)
+		return time.Date(months/12, time.Month(months%12+1), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		year := t.Year() - positiveMod(t.Year(), s.Count)
+		return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func (s timeStep) Next(t time.Time) time.Time {
+	switch s.Unit {
+	case timeHour:
+		return t.Add(time.Duration(s.Count) * time.Hour)
+	case timeDay:
+		return t.AddDate(0, 0, s.Count)
+	case timeWeek:
+		return t.AddDate(0, 0, 7*s.Count)
+	case timeMonth:
+		return t.AddDate(0, s.Count, 0)
+	default:
+		return t.AddDate(s.Count, 0, 0)
+	}
+}
+
+func (s timeStep) Format(t time.Time) string {
+	switch s.Unit {
+	case timeHour:
+		return t.Format("Jan 2 15:04")
+	case timeDay, timeWeek:
+		return t.Format("2006-01-02")
+	case timeMonth:
+		return t.Format("Jan 2006")
+	default:
+		return t.Format("2006")
+	}
+}
+
+func positiveMod(a, b int) int {
+	return ((a % b) + b) % b
+}
+
+func unixTime(v float64) time.Time {
+	return time.Unix(int64(math.Floor(v)), 0).UTC()
+}
+
+// The formats SQLite's date and time functions produce, along with the ones
+// the driver understands.
+var chartTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseChartTime Reads a date or time out of a query result, as a time.Time
+// or as text. Times without a zone are taken to be UTC.
+func parseChartTime(v interface{}) (time.Time, bool) {
+	var s string
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case string:
+		s = val
+	case []byte:
+		s = string(val)
+	default:
+		return time.Time{}, false
+	}
+
+	s = strings.TrimSuffix(strings.TrimSpace(s), "Z")
+	for _, layout := range chartTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// chartTimeFormatter Gets a function that formats times the same way as an
+// existing label, so that made up labels match the real ones.
+func chartTimeFormatter(label string) func(t time.Time) string {
+	s := strings.TrimSpace(label)
+	zulu := strings.HasSuffix(s, "Z")
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range chartTimeLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return func(t time.Time) string {
+				res := t.Format(layout)
+				if zulu {
+					res += "Z"
+				}
+				return res
+			}
+		}
+	}
+	return func(t time.Time) string {
+		return chartLabel(t)
+	}
+}
+
+// newTimeAxis Makes an axis from min to max with ticks on the smallest
+// calendar step that leaves room for every label.
+func newTimeAxis(cv chartCanvas, min, max float64, length float32, title string) chartAxis {
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		labelWidth := cv.MeasureText(s.Format(unixTime(min)), chartTextSize).X + 4*chartPadding
+		if (max-min)/s.Seconds() <= float64(length/labelWidth) {
+			step = s
+			break
+		}
+	}
+	return chartAxis{
+		Min:      min,
+		Max:      max,
+		TimeStep: step,
+		Title:    title,
+	}
+}
+
+// The shortest time between two neighboring points, or a day if there is
+// only one.
+func closestTimeGap(times []float64) float64 {
+	closest := math.Inf(1)
+	for i := 1; i < len(times); i++ {
+		if gap := times[i] - times[i-1]; gap > 0 && gap < closest {
+			closest = gap
+		}
+	}
+	if math.IsInf(closest, 1) {
+		return secondsPerDay
+	}
+	return closest
+}
+
+// The most points fillTimeGaps will make, so a stray date far in the past
+// doesn't turn into millions of empty days.
+const maxFilledTimes = 10000
+
+// fillTimeGaps Adds a zero wherever the data skips a step, so that missing
+// days (or weeks, months, or years) show up instead of being bridged over.
+// The step is guessed from the closest two points, and the new labels are
+// written like the first one. Points finer than a day are left alone. Times
+// must be sorted.
+func fillTimeGaps(data *chartData) {
+	if len(data.Times) < 2 {
+		return
+	}
+
+	var step timeStep
+	switch gap := closestTimeGap(data.Times); {
+	case gap < secondsPerDay:
+		return
+	case gap >= 365*secondsPerDay:
+		step = timeStep{timeYear, 1}
+	case gap >= 28*secondsPerDay:
+		step = timeStep{timeMonth, 1}
+	case gap >= 7*secondsPerDay:
+		step = timeStep{timeWeek, 1}
+	default:
+		step = timeStep{timeDay, 1}
+	}
+	if (data.Times[len(data.Times)-1]-data.Times[0])/step.Seconds() > maxFilledTimes {
+		return
+	}
+
+	format := chartTimeFormatter(data.Labels[0])
+	var labels []string
+	var times []float64
+	values := make([][]float64, len(data.Series))
+	i := 0
+	for t := step.Floor(unixTime(data.Times[0])); i < len(data.Times); t = step.Next(t) {
+		next := float64(step.Next(t).Unix())
+		if data.Times[i] >= next {
+			labels = append(labels, format(t))
+			times = append(times, float64(t.Unix()))
+			for si := range values {
+				values[si] = append(values[si], 0)
+			}
+			continue
+		}
+		for ; i < len(data.Times) && data.Times[i] < next; i++ {
+			labels = append(labels, data.Labels[i])
+			times = append(times, data.Times[i])
+			for si, s := range data.Series {
+				values[si] = append(values[si], s.Values[i])
+			}
+		}
+	}
+
+	data.Labels = labels
+	data.Times = times
+	for si := range data.Series {
+		data.Series[si].Values = values[si]
+	}
+}
+
+// chartTimeView The part of a time axis being shown, for zooming and panning.
+// The renderer fills in the rest, so that the mouse can be mapped back onto
+// the axis the next frame.
+type chartTimeView struct {
+	Start, End float64 // both zero shows everything
+
+	left, right float32 // where the axis was drawn
+	min, max    float64 // the full range of the data
+}
+
+func (v *chartTimeView) Zoomed() bool {
+	return v.Start < v.End
+}
+
+// Range Gets the part of the axis to show, kept within the data.
+func (v *chartTimeView) Range() (start, end float64) {
+	if !v.Zoomed() || v.End-v.Start >= v.max-v.min {
+		return v.min, v.max
+	}
+	start, end = v.Start, v.End
+	if start < v.min {
+		start, end = v.min, v.min+(end-start)
+	}
+	if end > v.max {
+		start, end = v.max-(end-start), v.max
+	}
+	return start, end
+}
+
+func (v *chartTimeView) timeAt(x float32) float64 {
+	start, end := v.Range()
+	if v.right <= v.left {
+		return start
+	}
+	return start + float64((x-v.left)/(v.right-v.left))*(end-start)
+}
+
+func (v *chartTimeView) set(start, end float64) {
+	v.Start, v.End = start, end
+	if end-start >= v.max-v.min {
+		v.Start, v.End = 0, 0
+		return
+	}
+	v.Start, v.End = v.Range()
+}
+
+// ZoomAt Zooms in (factor < 1) or out (factor > 1), keeping the time under
+// x where it is.
+func (v *chartTimeView) ZoomAt(x float32, factor float64) {
+	start, end := v.Range()
+	t := v.timeAt(x)
+	newStart, newEnd := t-(t-start)*factor, t+(end-t)*factor
+	if newEnd-newStart < (v.max-v.min)/1000 {
+		return
+	}
+	v.set(newStart, newEnd)
+}
+
+// PanFrom Moves the view from where it was at the start of a drag, dx to
+// the right on screen.
+func (v *chartTimeView) PanFrom(from chartTimeView, dx float32) {
+	if !from.Zoomed() || v.right <= v.left {
+		return
+	}
+	start, end := from.Range()
+	shift := -float64(dx/(v.right-v.left)) * (end - start)
+	v.set(start+shift, end+shift)
+}
+
+// drawTimeChart Draws a bar, line, or area chart with its points placed by
+// time rather than one slot each. Bars are as wide as the closest two points
+// allow.
+func drawTimeChart(cv chartCanvas, bounds rl.Rectangle, typ ChartType, data *chartData, ink rl.Color) []chartMark {
+	stacked := data.Stacked && typ.CanStack()
+	rangeValues := allSeriesValues(data.Series)
+	if stacked {
+		rangeValues = stackedTotals(data.Series)
+	}
+	min, max := chartValueRange(rangeValues, typ != LineChart)
+
+	// Leave half a bar of room at each end, so the first and last bars fit.
+	gap := closestTimeGap(data.Times)
+	start, end := data.Times[0]-gap/2, data.Times[len(data.Times)-1]+gap/2
+	view := data.TimeView
+	if view != nil {
+		view.min, view.max = start, end
+		start, end = view.Range()
+	}
+
+	textHeight := cv.MeasureText("Ag", chartTextSize).Y
+	xAxis := newTimeAxis(cv, start, end, bounds.Width, data.XTitle)
+	yAxis := newValueAxis(min, max, bounds.Height, 2.5*textHeight, data.YTitle)
+	plot := layoutChartAxes(cv, bounds, &xAxis, &yAxis)
+	drawChartAxes(cv, bounds, plot, xAxis, yAxis, ink)
+
+	left, right := plot.X, plot.X+plot.Width
+	if view != nil {
+		view.left, view.right = left, right
+	}
+
+	if yAxis.Min < 0 && yAxis.Max > 0 {
+		zero := yAxis.Pos(0)
+		cv.Line(rl.Vector2{left, zero}, rl.Vector2{right, zero}, 1, ink)
+	}
+
+	slot := float32(gap) * (right - left) / float32(end-start)
+	const spacingBetweenGroups = 0.5 // times width of a group
+	groupWidth := slot / (1 + spacingBetweenGroups)
+
+	stackUp := make([]float64, len(data.Times))
+	stackDown := make([]float64, len(data.Times))
+
+	var marks []chartMark
+	for si, s := range data.Series {
+		color := seriesColor(data, si, ink)
+
+		addPointMarks := func(points []*rl.Vector2) {
+			for i, p := range points {
+				if p == nil || math.IsNaN(s.Values[i]) || p.X < left || p.X > right {
+					continue
+				}
+				marks = append(marks, chartMark{
+					Rect:   rl.Rectangle{p.X - slot/2, plot.Y, slot, plot.Height},
+					Point:  *p,
+					Label:  data.Labels[i],
+					Series: s.Name,
+					Value:  s.Values[i],
+				})
+			}
+		}
+
+		switch typ {
+		case BarChart:
+			barWidth := groupWidth / float32(len(data.Series))
+			if stacked {
+				barWidth = groupWidth
+			}
+			for i, v := range s.Values {
+				if math.IsNaN(v) {
+					continue
+				}
+				barStart := xAxis.Pos(data.Times[i]) - groupWidth/2
+				from := 0.0
+				if stacked {
+					if v >= 0 {
+						from, stackUp[i] = stackUp[i], stackUp[i]+v
+					} else {
+						from, stackDown[i] = stackDown[i], stackDown[i]+v
+					}
+				} else {
+					barStart += float32(si) * barWidth
+				}
+				bar, ok := clipChartRectX(chartBarRect(barStart, barWidth, yAxis.Pos(from), yAxis.Pos(from+v), false), left, right)
+				if !ok {
+					continue
+				}
+				cv.Rect(bar, data.labelColor(data.Labels[i], color))
+				marks = append(marks, chartMark{
+					Rect:   growChartRect(bar, 6),
+					Point:  rl.Vector2{bar.X + bar.Width/2, bar.Y + bar.Height/2},
+					Label:  data.Labels[i],
+					Series: s.Name,
+					Value:  v,
+				})
+			}
+		case LineChart:
+			points := timePoints(s.Values, data.Times, xAxis, yAxis)
+			drawClippedChartLine(cv, points, left, right, slot, color)
+			addPointMarks(points)
+		case AreaChart:
+			values, bases := s.Values, make([]float64, len(s.Values))
+			if stacked {
+				values = make([]float64, len(s.Values))
+				for i, v := range s.Values {
+					if math.IsNaN(v) {
+						v = 0
+					}
+					bases[i] = stackUp[i]
+					values[i] = stackUp[i] + v
+					stackUp[i] = values[i]
+				}
+			}
+
+			points := timePoints(values, data.Times, xAxis, yAxis)
+			basePoints := timePoints(bases, data.Times, xAxis, yAxis)
+			fill := withAlpha(color, 0.4)
+			for i := 1; i < len(points); i++ {
+				if points[i-1] == nil || points[i] == nil {
+					continue
+				}
+				a, b, ok := clipChartSegmentX(*points[i-1], *points[i], left, right)
+				aBase, bBase, _ := clipChartSegmentX(*basePoints[i-1], *basePoints[i], left, right)
+				if ok {
+					drawBandSegment(cv, a, b, aBase, bBase, fill)
+				}
+			}
+			drawClippedChartLine(cv, points, left, right, slot, color)
+			addPointMarks(points)
+		}
+	}
+
+	return marks
+}
+
+// The screen position of each value at its time, or nil for missing values.
+func timePoints(values []float64, times []float64, xAxis, yAxis chartAxis) []*rl.Vector2 {
+	points := make([]*rl.Vector2, len(values))
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		points[i] = &rl.Vector2{xAxis.Pos(times[i]), yAxis.Pos(v)}
+	}
+	return points
+}
+
+// Cuts off the parts of a rectangle outside of left to right, or returns
+// false if none of it is inside.
+func clipChartRectX(r rl.Rectangle, left, right float32) (rl.Rectangle, bool) {
+	if r.X+r.Width <= left || r.X >= right {
+		return r, false
+	}
+	if r.X < left {
+		r.Width -= left - r.X
+		r.X = left
+	}
+	if r.X+r.Width > right {
+		r.Width = right - r.X
+	}
+	return r, true
+}
+
+// Cuts off the parts of a segment outside of left to right, or returns false
+// if none of it is inside. a must be left of b.
+func clipChartSegmentX(a, b rl.Vector2, left, right float32) (rl.Vector2, rl.Vector2, bool) {
+	if b.X < left || a.X > right || b.X <= a.X {
+		return a, b, false
+	}
+	at := func(x float32) rl.Vector2 {
+		return rl.Vector2{x, a.Y + (b.Y-a.Y)*(x-a.X)/(b.X-a.X)}
+	}
+	if a.X < left {
+		a = at(left)
+	}
+	if b.X > right {
+		b = at(right)
+	}
+	return a, b, true
+}
+
+// Like drawChartLine, but only the part between left and right.
+func drawClippedChartLine(cv chartCanvas, points []*rl.Vector2, left, right float32, slot float32, color rl.Color) {
+	for i, p := range points {
+		if p == nil {
+			continue
+		}
+		connectedBefore := i > 0 && points[i-1] != nil
+		connectedAfter := i+1 < len(points) && points[i+1] != nil
+		if connectedAfter {
+			if a, b, ok := clipChartSegmentX(*p, *points[i+1], left, right); ok {
+				cv.Line(a, b, 3, color)
+			}
+		}
+		if left <= p.X && p.X <= right && (slot >= 16 || !connectedBefore && !connectedAfter) {
+			cv.Circle(*p, 4, color)
+		}
+	}
+}
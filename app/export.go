@@ -0,0 +1,401 @@
+package app
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type ExportFormat int
+
+const (
+	ExportCSV ExportFormat = iota + 1
+	ExportJSON
+	ExportNDJSON
+)
+
+func (f ExportFormat) Extension() string {
+	switch f {
+	case ExportJSON:
+		return ".json"
+	case ExportNDJSON:
+		return ".ndjson"
+	default:
+		return ".csv"
+	}
+}
+
+type ExportOptions struct {
+	Format    ExportFormat
+	Delimiter rune   // CSV only
+	Header    bool   // CSV only
+	Null      string // how NULL is written in CSV
+}
+
+var exportFormatOpts = []raygui.DropdownExOption{
+	{"CSV", ExportCSV},
+	{"JSON", ExportJSON},
+	{"NDJSON", ExportNDJSON},
+}
+
+var exportDelimiterOpts = []raygui.DropdownExOption{
+	{"Comma", ','},
+	{"Semicolon", ';'},
+	{"Tab", '\t'},
+	{"Pipe", '|'},
+}
+
+// Runs a query and writes every row to a file. Rows are written as they come
+// in, so the full result never has to fit in memory. Returns the number of
+// rows written.
+func exportQuery(path string, query string, opts ExportOptions) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	count, err := exportRows(w, query, opts)
+	if err != nil {
+		return count, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	return count, f.Close()
+}
+
+func exportRows(w io.Writer, query string, opts ExportOptions) (int, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	var csvWriter *csv.Writer
+	switch opts.Format {
+	case ExportJSON:
+		io.WriteString(w, "[")
+	case ExportNDJSON:
+	default:
+		csvWriter = csv.NewWriter(w)
+		if opts.Delimiter != 0 {
+			csvWriter.Comma = opts.Delimiter
+		}
+		if opts.Header {
+			csvWriter.Write(cols)
+		}
+	}
+
+	row := make([]interface{}, len(cols))
+	rowPointers := make([]interface{}, len(row))
+	for i := range row {
+		rowPointers[i] = &row[i]
+	}
+	record := make([]string, len(cols))
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(rowPointers...); err != nil {
+			return count, err
+		}
+
+		switch opts.Format {
+		case ExportJSON, ExportNDJSON:
+			if opts.Format == ExportJSON {
+				if count > 0 {
+					io.WriteString(w, ",")
+				}
+				io.WriteString(w, "\n\t")
+			}
+			if err := writeJSONObject(w, cols, row); err != nil {
+				return count, err
+			}
+			if opts.Format == ExportNDJSON {
+				io.WriteString(w, "\n")
+			}
+		default:
+			for i, v := range row {
+				if v == nil {
+					record[i] = opts.Null
+				} else {
+					record[i] = exportText(v)
+				}
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return count, err
+			}
+		}
+
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	if opts.Format == ExportJSON {
+		io.WriteString(w, "\n]\n")
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return count, csvWriter.Error()
+	}
+
+	return count, nil
+}
+
+// Writes a row as a JSON object, keeping the keys in column order.
+func writeJSONObject(w io.Writer, cols []string, row []interface{}) error {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, col := range cols {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(exportJSONValue(row[i]))
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(val)
+	}
+	b.WriteString("}")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+/*
+The driver hands us int64, float64, string, []byte, bool, time.Time, or nil.
+Blobs are written as text when they're valid UTF-8 (SQLite happily stores text
+as blobs) and base64 otherwise. Times use SQLite's own format.
+*/
+
+func exportText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return base64.StdEncoding.EncodeToString(val)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func exportJSONValue(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, int64, float64, bool, string:
+		return v
+	default:
+		return exportText(v)
+	}
+}
+
+// ExportSettings holds the export options along with the UI to edit them. It
+// is shared by the Export node and the results pane.
+type ExportSettings struct {
+	ExportOptions
+	Path   string
+	Status string
+
+	PathTextbox       raygui.TextBoxEx
+	FormatDropdown    raygui.DropdownEx
+	DelimiterDropdown raygui.DropdownEx
+	NullTextbox       raygui.TextBoxEx
+}
+
+func NewExportSettings() ExportSettings {
+	return ExportSettings{
+		ExportOptions: ExportOptions{
+			Format:    ExportCSV,
+			Delimiter: ',',
+			Header:    true,
+			Null:      "",
+		},
+		Path: "export.csv",
+	}
+}
+
+func (s *ExportSettings) Dropdowns() []*raygui.DropdownEx {
+	return []*raygui.DropdownEx{&s.FormatDropdown, &s.DelimiterDropdown}
+}
+
+func (s *ExportSettings) Update() {
+	s.FormatDropdown.SetOptions(exportFormatOpts...)
+	s.DelimiterDropdown.SetOptions(exportDelimiterOpts...)
+}
+
+// Sets the format, fixing up the file extension to match.
+func (s *ExportSettings) SetFormat(format ExportFormat) {
+	if format == 0 || format == s.Format {
+		return
+	}
+	if ext := filepath.Ext(s.Path); ext == s.Format.Extension() {
+		s.Path = strings.TrimSuffix(s.Path, ext) + format.Extension()
+	}
+	s.Format = format
+}
+
+// Exports the results of the query returned by getQuery. The query is only
+// generated when it's actually needed, and an empty query means there's
+// nothing to export.
+func (s *ExportSettings) Export(getQuery func() string) {
+	if strings.TrimSpace(s.Path) == "" {
+		s.Status = "Enter a file name."
+		return
+	}
+	query := getQuery()
+	if query == "" {
+		s.Status = "Nothing to export."
+		return
+	}
+
+	count, err := exportQuery(s.Path, query, s.ExportOptions)
+	if err != nil {
+		s.Status = err.Error()
+	} else {
+		s.Status = fmt.Sprintf("Exported %d rows to %s.", count, s.Path)
+	}
+}
+
+// Lays out the export controls in a single row, for the results pane.
+func (s *ExportSettings) DoRowUI(bounds rl.Rectangle, getQuery func() string) {
+	const pathWidth = 300 * zoomLevel
+	const formatWidth = 120 * zoomLevel
+	const delimiterWidth = 140 * zoomLevel
+	const headerWidth = 110 * zoomLevel
+	const nullWidth = 100 * zoomLevel
+	const buttonWidth = 110 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(s.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldX := bounds.X
+	fieldRect := func(width float32) rl.Rectangle {
+		rect := rl.Rectangle{fieldX, bounds.Y, width, UIFieldHeight}
+		fieldX += width + UIFieldSpacing
+		return rect
+	}
+
+	s.Path, _ = s.PathTextbox.Do(fieldRect(pathWidth), s.Path, 200)
+	formatRect := fieldRect(formatWidth)
+	delimiterRect := fieldRect(delimiterWidth)
+	s.Header = raygui.Toggle(fieldRect(headerWidth), "Header", s.Header)
+	s.Null, _ = s.NullTextbox.Do(fieldRect(nullWidth), s.Null, 20)
+	if raygui.Button(fieldRect(buttonWidth), "Export") {
+		s.Export(getQuery)
+	}
+	drawBasicText(s.Status, fieldX, bounds.Y+(UIFieldHeight-textSize)/2, textSize, PaneFontColor)
+
+	// dropdowns last so they draw on top
+	func() {
+		if openDropdown == &s.DelimiterDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		if s.Format != ExportCSV {
+			raygui.Disable()
+			defer raygui.Enable()
+		}
+		delimiter := s.DelimiterDropdown.Do(delimiterRect)
+		s.Delimiter, _ = delimiter.(rune)
+	}()
+	func() {
+		if openDropdown == &s.FormatDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		format, _ := s.FormatDropdown.Do(formatRect).(ExportFormat)
+		s.SetFormat(format)
+	}()
+}
+
+// Lays out the export controls stacked vertically, for the Export node.
+func (s *ExportSettings) DoStackedUI(bounds rl.Rectangle, getQuery func() string) {
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(s.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	halfWidth := bounds.Width/2 - UIFieldSpacing/2
+	rightX := bounds.X + bounds.Width/2 + UIFieldSpacing/2
+
+	fieldY := bounds.Y
+	s.Path, _ = s.PathTextbox.Do(rl.Rectangle{bounds.X, fieldY, bounds.Width, UIFieldHeight}, s.Path, 200)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	dropdownY := fieldY
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	s.Header = raygui.Toggle(rl.Rectangle{bounds.X, fieldY, halfWidth, UIFieldHeight}, "Header", s.Header)
+	s.Null, _ = s.NullTextbox.Do(rl.Rectangle{rightX, fieldY, halfWidth, UIFieldHeight}, s.Null, 20)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	drawBasicText(s.Status, bounds.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	if raygui.Button(rl.Rectangle{bounds.X, fieldY, bounds.Width, UIFieldHeight}, "Export") {
+		s.Export(getQuery)
+	}
+
+	// dropdowns last so they draw on top
+	func() {
+		if openDropdown == &s.DelimiterDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		if s.Format != ExportCSV {
+			raygui.Disable()
+			defer raygui.Enable()
+		}
+		delimiter := s.DelimiterDropdown.Do(rl.Rectangle{rightX, dropdownY, halfWidth, UIFieldHeight})
+		s.Delimiter, _ = delimiter.(rune)
+	}()
+	func() {
+		if openDropdown == &s.FormatDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		format, _ := s.FormatDropdown.Do(rl.Rectangle{bounds.X, dropdownY, halfWidth, UIFieldHeight}).(ExportFormat)
+		s.SetFormat(format)
+	}()
+}
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"database/sql"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+/*
+SQLite has no REGEXP implementation and very few statistical functions, so we
+provide our own. They are registered on every connection through a custom
+driver, which openDB uses instead of the plain "sqlite3" one.
+
+The driver can't return NULL from a Go function directly, but SQLite turns a
+NaN result into NULL, so numeric functions return NaN when there's no answer.
+*/
+
+const sqliteDriverName = "sqlite3_sqljam"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: registerFunctions,
+	})
+}
+
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	funcs := []struct {
+		name string
+		impl interface{}
+	}{
+		{"regexp", sqlRegexp},
+		{"regexp_replace", sqlRegexpReplace},
+		{"similarity", sqlSimilarity},
+	}
+	for _, f := range funcs {
+		if err := conn.RegisterFunc(f.name, f.impl, true); err != nil {
+			return err
+		}
+	}
+
+	aggs := []struct {
+		name string
+		impl interface{}
+	}{
+		{"median", newMedianAgg},
+		{"percentile", newPercentileAgg},
+		{"stddev", newStdDevAgg},
+		{"variance", newVarianceAgg},
+	}
+	for _, a := range aggs {
+		if err := conn.RegisterAggregator(a.name, a.impl, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compiled patterns, since the same pattern is used for every row.
+var regexpCache = map[string]*regexp.Regexp{}
+var regexpCacheLock sync.Mutex
+
+func compileCached(pattern string) (*regexp.Regexp, error) {
+	regexpCacheLock.Lock()
+	defer regexpCacheLock.Unlock()
+
+	if re, ok := regexpCache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache[pattern] = re
+	return re, nil
+}
+
+// Implements "x REGEXP pattern", which SQLite turns into regexp(pattern, x).
+// NULL never matches.
+func sqlRegexp(pattern string, s interface{}) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	re, err := compileCached(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(sqlText(s)), nil
+}
+
+// regexp_replace(s, pattern, replacement). The replacement can refer to
+// groups as $1, $2, etc. NULL comes back as empty text.
+func sqlRegexpReplace(s interface{}, pattern string, replacement string) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	re, err := compileCached(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(sqlText(s), replacement), nil
+}
+
+// similarity(a, b) gives a score from 0 (nothing alike) to 1 (identical),
+// ignoring case. It's based on the edit distance between the strings.
+func sqlSimilarity(a, b interface{}) float64 {
+	if a == nil || b == nil {
+		return math.NaN()
+	}
+	ra := []rune(strings.ToLower(sqlText(a)))
+	rb := []rune(strings.ToLower(sqlText(b)))
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1.0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// Counts the single-character edits needed to turn one string into the other.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func sqlText(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return exportText(v)
+	}
+}
+
+// Gets the numeric value of an aggregate's input. NULLs and text that isn't
+// a number are skipped, like SQLite's own AVG would.
+func sqlNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case string, []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(sqlText(val)), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Collects values for median and percentile, which need to see all of them.
+type sortedValuesAgg struct {
+	values  []float64
+	percent float64
+}
+
+func newMedianAgg() *medianAgg {
+	return &medianAgg{sortedValuesAgg{percent: 50}}
+}
+
+func newPercentileAgg() *percentileAgg {
+	return &percentileAgg{}
+}
+
+type medianAgg struct {
+	sortedValuesAgg
+}
+
+func (a *medianAgg) Step(v interface{}) {
+	if f, ok := sqlNumber(v); ok {
+		a.values = append(a.values, f)
+	}
+}
+
+func (a *medianAgg) Done() float64 {
+	return a.result()
+}
+
+// percentile(x, p) takes p from 0 to 100.
+type percentileAgg struct {
+	sortedValuesAgg
+}
+
+func (a *percentileAgg) Step(v interface{}, percent interface{}) {
+	a.percent, _ = sqlNumber(percent)
+	if f, ok := sqlNumber(v); ok {
+		a.values = append(a.values, f)
+	}
+}
+
+func (a *percentileAgg) Done() float64 {
+	return a.result()
+}
+
+// Finds the value at a percentile, interpolating between the two nearest
+// values like most spreadsheets do.
+func (a *sortedValuesAgg) result() float64 {
+	if len(a.values) == 0 {
+		return math.NaN()
+	}
+	sort.Float64s(a.values)
+
+	p := math.Max(0, math.Min(100, a.percent)) / 100
+	pos := p * float64(len(a.values)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	frac := pos - float64(lower)
+	return a.values[lower] + (a.values[upper]-a.values[lower])*frac
+}
+
+// Computes the sample variance using Welford's method, which stays accurate
+// for large numbers of rows.
+type varianceAgg struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+type stdDevAgg struct {
+	varianceAgg
+}
+
+func newVarianceAgg() *varianceAgg {
+	return &varianceAgg{}
+}
+
+func newStdDevAgg() *stdDevAgg {
+	return &stdDevAgg{}
+}
+
+func (a *varianceAgg) Step(v interface{}) {
+	f, ok := sqlNumber(v)
+	if !ok {
+		return
+	}
+	a.n++
+	delta := f - a.mean
+	a.mean += delta / float64(a.n)
+	a.m2 += delta * (f - a.mean)
+}
+
+func (a *varianceAgg) variance() (float64, bool) {
+	if a.n < 2 {
+		return 0, false
+	}
+	return a.m2 / float64(a.n-1), true
+}
+
+func (a *varianceAgg) Done() float64 {
+	if v, ok := a.variance(); ok {
+		return v
+	}
+	return math.NaN()
+}
+
+func (a *stdDevAgg) Done() float64 {
+	if v, ok := a.variance(); ok {
+		return math.Sqrt(v)
+	}
+	return math.NaN()
+}
@@ -2,7 +2,10 @@ package app
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type SqlSource interface {
@@ -16,6 +19,11 @@ type SqlSource interface {
 // we continue recursive generation with a new Source context object.
 // Thus this is basically a recursive tree
 type QueryContext struct {
+	// Common table expressions emitted in a WITH clause ahead of the query.
+	// The Source will usually refer to one of them by name.
+	CTEs          []GenCTE
+	RecursiveCTEs bool
+
 	Source SqlSource // or NodeGenContext
 
 	// Picked columns and aggregates are mutually exclusive.
@@ -64,6 +72,11 @@ func WrapQueryContext(ctx *QueryContext) *QueryContext {
 	}
 }
 
+type GenCTE struct {
+	Name   string
+	Source SqlSource
+}
+
 type GenColumn struct {
 	Col   string
 	Alias string
@@ -75,9 +88,67 @@ type GenAggregate struct {
 }
 
 type GenAggregateEntry struct {
-	Type  AggregateType
-	Col   string
-	Alias string
+	Type   AggregateType
+	Col    string
+	Arg    string
+	Alias  string
+	Filter string
+}
+
+// Sql Renders the aggregate as it appears in the SELECT list, e.g.
+// "SUM(amount) FILTER (WHERE amount > 0) AS total".
+func (agg GenAggregateEntry) Sql() string {
+	name, distinct := "ERROR", false
+	switch agg.Type {
+	case Avg:
+		name = "AVG"
+	case AvgDistinct:
+		name, distinct = "AVG", true
+	case Max:
+		name = "MAX"
+	case Min:
+		name = "MIN"
+	case Sum:
+		name = "SUM"
+	case SumDistinct:
+		name, distinct = "SUM", true
+	case Total:
+		name = "TOTAL"
+	case Count, CountAll:
+		name = "COUNT"
+	case CountDistinct:
+		name, distinct = "COUNT", true
+	case GroupConcat:
+		name = "GROUP_CONCAT"
+	case Median:
+		name = "MEDIAN"
+	case Percentile:
+		name = "PERCENTILE"
+	case StdDev:
+		name = "STDDEV"
+	case Variance:
+		name = "VARIANCE"
+	}
+
+	args := agg.Col
+	if !agg.Type.HasCol() {
+		args = "*"
+	}
+	if agg.Type.HasArg() {
+		args += ", " + agg.Arg
+	}
+	if distinct {
+		args = "DISTINCT " + args
+	}
+	sql := fmt.Sprintf("%s(%s)", name, args)
+
+	if strings.TrimSpace(agg.Filter) != "" {
+		sql += fmt.Sprintf(" FILTER (WHERE %s)", agg.Filter)
+	}
+	if agg.Alias != "" {
+		sql += fmt.Sprintf(" AS %s", agg.Alias)
+	}
+	return sql
 }
 
 type GenCombine struct {
@@ -88,13 +159,49 @@ type GenCombine struct {
 type GenSort struct {
 	Col        string
 	Descending bool
+	Nulls      NullsOrder
+	NoCase     bool
+}
+
+// Sql Renders the sort as it appears in ORDER BY. SQLite before 3.30 has no
+// NULLS FIRST or NULLS LAST, so on those versions NULLs are moved with an
+// extra sort term instead.
+func (sort GenSort) Sql() string {
+	sql := sort.Col
+	if sort.NoCase {
+		sql += " COLLATE NOCASE"
+	}
+	if sort.Descending {
+		sql += " DESC"
+	}
+
+	// By default SQLite puts NULLs first when ascending and last when
+	// descending, so only the opposite needs any work.
+	nullsFirst := sort.Nulls == NullsFirst
+	if sort.Nulls == NullsDefault || nullsFirst != sort.Descending {
+		return sql
+	}
+
+	if sqliteVersionAtLeast(3, 30, 0) {
+		if nullsFirst {
+			return sql + " NULLS FIRST"
+		}
+		return sql + " NULLS LAST"
+	}
+
+	if nullsFirst {
+		return fmt.Sprintf("(%s) IS NULL DESC, %s", sort.Col, sql)
+	}
+	return fmt.Sprintf("(%s) IS NULL, %s", sort.Col, sql)
 }
 
 type GenJoin struct {
 	Type      JoinType
+	Natural   bool
 	Source    SqlSource
 	Alias     string
 	Condition string
+	Using     []string
 }
 
 func indented(s string, amount int) string {
@@ -105,6 +212,23 @@ func indented(s string, amount int) string {
 func (ctx *QueryContext) SourceToSql(indent int) string {
 	var sql string
 
+	if len(ctx.CTEs) > 0 {
+		if ctx.RecursiveCTEs {
+			sql += indented("WITH RECURSIVE ", indent)
+		} else {
+			sql += indented("WITH ", indent)
+		}
+		for i, cte := range ctx.CTEs {
+			if i > 0 {
+				sql += ",\n" + indented("", indent)
+			}
+			body := strings.TrimSuffix(cte.Source.SourceToSql(indent+1), "\n")
+			sql += fmt.Sprintf("%s AS (\n%s", cte.Name, body)
+			sql += "\n" + indented(")", indent)
+		}
+		sql += "\n"
+	}
+
 	if len(ctx.Combines) > 0 {
 		sql += ctx.Source.SourceToSql(indent)
 		for _, gc := range ctx.Combines {
@@ -135,28 +259,7 @@ func (ctx *QueryContext) SourceToSql(indent int) string {
 				colStrings = append(colStrings, gbCol)
 			}
 			for _, agg := range ctx.Aggregate.Aggs {
-				op := "ERROR("
-				switch agg.Type {
-				case Avg:
-					op = "AVG("
-				case Max:
-					op = "MAX("
-				case Min:
-					op = "MIN("
-				case Sum:
-					op = "SUM("
-				case Count:
-					op = "COUNT("
-				case CountDistinct:
-					op = "COUNT(DISTINCT "
-				}
-
-				aliasStr := ""
-				if agg.Alias != "" {
-					aliasStr = fmt.Sprintf(" AS %s", agg.Alias)
-				}
-
-				colStrings = append(colStrings, fmt.Sprintf("%s%s)%s", op, agg.Col, aliasStr))
+				colStrings = append(colStrings, agg.Sql())
 			}
 			sql += strings.Join(colStrings, ", ")
 		} else if len(ctx.Cols) == 0 {
@@ -190,7 +293,11 @@ func (ctx *QueryContext) SourceToSql(indent int) string {
 			sql += fmt.Sprintf(" AS %s", ctx.JoinSourceAlias)
 		}
 		for _, join := range ctx.Joins {
-			sql += "\n" + indented(join.Type.String(), indent) + " "
+			natural := ""
+			if join.Natural {
+				natural = "NATURAL "
+			}
+			sql += "\n" + indented(natural+join.Type.String(), indent) + " "
 			if join.Source.IsTable() {
 				sql += join.Source.(*Table).Table
 			} else {
@@ -200,7 +307,9 @@ func (ctx *QueryContext) SourceToSql(indent int) string {
 			if join.Alias != "" {
 				sql += fmt.Sprintf(" AS %s", join.Alias)
 			}
-			if join.Condition != "" {
+			if len(join.Using) > 0 {
+				sql += fmt.Sprintf(" USING (%s)", strings.Join(join.Using, ", "))
+			} else if join.Condition != "" {
 				sql += fmt.Sprintf(" ON %s", join.Condition)
 			}
 		}
@@ -225,11 +334,7 @@ func (ctx *QueryContext) SourceToSql(indent int) string {
 		sql += "\n" + indented("ORDER BY ", indent)
 		var sortStrings []string
 		for _, sort := range ctx.Sorts {
-			direction := ""
-			if sort.Descending {
-				direction = " DESC"
-			}
-			sortStrings = append(sortStrings, fmt.Sprintf("%s%s", sort.Col, direction))
+			sortStrings = append(sortStrings, sort.Sql())
 		}
 		sql += strings.Join(sortStrings, ", ")
 	}
@@ -237,6 +342,366 @@ func (ctx *QueryContext) SourceToSql(indent int) string {
 	return sql
 }
 
+// joinInputSchema The columns of one of a join's inputs.
+type joinInputSchema struct {
+	Alias       string
+	ColumnNames []string
+}
+
+// joinContext Sets up the FROM and JOIN clauses of a Join node. The schemas
+// line up with the inputs: the first is for the source, and the rest are for
+// each join in turn.
+func joinContext(n *Node, d *Join) (*QueryContext, []joinInputSchema) {
+	var inputSchemas []joinInputSchema
+
+	var firstSource SqlSource
+	if table, ok := n.Inputs[0].Data.(*Table); ok {
+		firstSource = table
+	} else {
+		firstSource = NewQueryContextFromNode(n.Inputs[0])
+	}
+	ctx := NewQueryContext()
+	ctx.Source = firstSource
+
+	ctx.JoinSourceAlias = d.FirstAlias
+	inputSchemas = append(inputSchemas, joinInputSchema{
+		Alias:       d.FirstAlias,
+		ColumnNames: getSchema(n.Inputs[0]),
+	})
+
+	// All other inputs get thrown into a new recursive context
+	for i, input := range n.Inputs[1:] {
+		if input == nil {
+			continue
+		}
+
+		alias := d.Conditions[i].Alias
+
+		inputSchemas = append(inputSchemas, joinInputSchema{
+			Alias:       alias,
+			ColumnNames: getSchema(input),
+		})
+
+		var source SqlSource
+		if table, ok := input.Data.(*Table); ok {
+			source = table
+		} else {
+			source = NewQueryContextFromNode(input)
+		}
+
+		cond := d.Conditions[i]
+		join := GenJoin{
+			Source: source,
+			Type:   cond.Type(),
+			Alias:  alias,
+		}
+		switch cond.Mode {
+		case JoinOn:
+			join.Condition = cond.Condition
+		case JoinUsing:
+			join.Using = cond.UsingCols()
+		case JoinNatural:
+			join.Natural = true
+		}
+		ctx.Joins = append(ctx.Joins, join)
+	}
+
+	return ctx, inputSchemas
+}
+
+// joinMatchCondition Gets the condition a join matches rows on. USING and
+// NATURAL joins are spelled out as comparisons; like SQLite, each column is
+// matched against the leftmost earlier input that has it.
+func joinMatchCondition(ctx *QueryContext, inputSchemas []joinInputSchema, joinIndex int) string {
+	join := ctx.Joins[joinIndex]
+	if len(join.Using) == 0 && !join.Natural {
+		return join.Condition
+	}
+
+	cols := join.Using
+	if join.Natural {
+		cols = inputSchemas[joinIndex+1].ColumnNames
+	}
+
+	var parts []string
+	for _, col := range cols {
+	found:
+		for _, schema := range inputSchemas[:joinIndex+1] {
+			for _, other := range schema.ColumnNames {
+				if other == col {
+					parts = append(parts, fmt.Sprintf("%s.%s = %s.%s", schema.Alias, col, join.Alias, col))
+					break found
+				}
+			}
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// emulateOuterJoin Rewrites a RIGHT or FULL join for versions of SQLite that
+// don't have them. "a RIGHT JOIN b" becomes "a JOIN b", plus (via UNION ALL)
+// the rows of b that matched nothing, with NULLs for a's columns. A FULL join
+// works the same way, but starts from "a LEFT JOIN b" instead.
+//
+// The query must list its columns explicitly, since the two halves of the
+// union join their inputs in different orders. Its WHERE conditions apply to
+// both halves.
+func emulateOuterJoin(ctx *QueryContext, joinIndex int, cond string) *QueryContext {
+	join := ctx.Joins[joinIndex]
+
+	matched := *ctx
+	matched.Joins = append([]GenJoin{}, ctx.Joins...)
+	if join.Type == FullJoin {
+		matched.Joins[joinIndex].Type = LeftJoin
+	} else {
+		matched.Joins[joinIndex].Type = InnerJoin
+	}
+
+	// The inputs before b, which b's rows have to be checked against.
+	earlierInputs := NewQueryContext()
+	earlierInputs.Source = ctx.Source
+	earlierInputs.JoinSourceAlias = ctx.JoinSourceAlias
+	earlierInputs.Joins = ctx.Joins[:joinIndex]
+
+	// The inputs before b are still joined so that their columns exist, but
+	// "ON 0" leaves them all NULL.
+	unmatched := NewQueryContext()
+	unmatched.Source = join.Source
+	unmatched.JoinSourceAlias = join.Alias
+	unmatched.Cols = ctx.Cols
+	unmatched.WhereConditions = ctx.WhereConditions
+	unmatched.Joins = append(unmatched.Joins, GenJoin{
+		Type:      LeftJoin,
+		Source:    ctx.Source,
+		Alias:     ctx.JoinSourceAlias,
+		Condition: "0",
+	})
+	for _, earlier := range ctx.Joins[:joinIndex] {
+		unmatched.Joins = append(unmatched.Joins, GenJoin{
+			Type:      LeftJoin,
+			Source:    earlier.Source,
+			Alias:     earlier.Alias,
+			Condition: "0",
+		})
+	}
+	unmatched.Joins = append(unmatched.Joins, ctx.Joins[joinIndex+1:]...)
+	unmatched = withMatches(unmatched, earlierInputs, cond, false)
+
+	union := WrapQueryContext(&matched)
+	union.Combines = []GenCombine{{Context: unmatched, Type: UnionAll}}
+	return WrapQueryContext(union)
+}
+
+// withMatches Filters a query down to the rows that have (or don't have) a
+// match in another query, according to a join condition.
+func withMatches(ctx *QueryContext, other *QueryContext, cond string, matched bool) *QueryContext {
+	return withExists(ctx, matchQuery(other, cond), matched)
+}
+
+// matchQuery Turns a query into one that finds matches for a join condition,
+// for use with withExists.
+func matchQuery(other *QueryContext, cond string) *QueryContext {
+	match := *other
+	match.Cols = []GenColumn{{Col: "1"}}
+	match.WhereConditions = nil
+	if cond != "" {
+		match.WhereConditions = []string{cond}
+	}
+	return &match
+}
+
+// withExists Filters a query down to the rows for which another query
+// returns (or doesn't return) anything.
+func withExists(ctx *QueryContext, match *QueryContext, matched bool) *QueryContext {
+	op := "EXISTS"
+	if !matched {
+		op = "NOT EXISTS"
+	}
+
+	res := *ctx
+	res.WhereConditions = append(append([]string{}, ctx.WhereConditions...), fmt.Sprintf("%s (\n%s\n)", op, match.SourceToSql(1)))
+	return &res
+}
+
+// emulatedJoin Finds the RIGHT or FULL join that older SQLite needs rewritten,
+// or -1 if there isn't one. Only one can be rewritten, so if there are more,
+// it's -1 too and the query fails.
+func emulatedJoin(joins []GenJoin) int {
+	emulated := -1
+	for i, join := range joins {
+		if !join.Type.NeedsEmulation() {
+			continue
+		}
+		if emulated >= 0 {
+			return -1
+		}
+		emulated = i
+	}
+	return emulated
+}
+
+// joinColumns Lists every column of a join's inputs, along with whether any
+// name appears in more than one input. Those get the input's alias as a
+// prefix so they stay apart.
+func joinColumns(inputSchemas []joinInputSchema) ([]GenColumn, bool) {
+	colCounts := map[string]int{}
+	for _, schema := range inputSchemas {
+		for _, col := range schema.ColumnNames {
+			colCounts[col]++
+		}
+	}
+
+	var cols []GenColumn
+	anyDuplicates := false
+	for _, schema := range inputSchemas {
+		for _, col := range schema.ColumnNames {
+			alias := ""
+			if colCounts[col] > 1 {
+				alias = fmt.Sprintf("%s_%s", schema.Alias, col)
+				anyDuplicates = true
+			}
+
+			cols = append(cols, GenColumn{
+				Col:   fmt.Sprintf("%s.%s", schema.Alias, col),
+				Alias: alias,
+			})
+		}
+	}
+	return cols, anyDuplicates
+}
+
+// joinStatsQuery The queries behind the match statistics for one join.
+type joinStatsQuery struct {
+	// Returns a single row: the rows on the left, how many of them matched,
+	// the same for the right, and the number of rows an inner join produces.
+	Counts string
+
+	LeftUnmatched  string
+	RightUnmatched string
+}
+
+// joinStatsQueries Builds the queries that count how rows match up across
+// each join in a Join node. The left side of a join is everything joined
+// before it, with any RIGHT or FULL join in there rewritten like in the Join
+// node's own query.
+func joinStatsQueries(n *Node, d *Join) []joinStatsQuery {
+	ctx, inputSchemas := joinContext(n, d)
+
+	emulate := func(c *QueryContext) *QueryContext {
+		emulated := emulatedJoin(c.Joins)
+		if emulated < 0 {
+			return c
+		}
+		res := *c
+		if len(res.Cols) == 0 {
+			res.Cols, _ = joinColumns(inputSchemas[:len(c.Joins)+1])
+		}
+		return emulateOuterJoin(&res, emulated, joinMatchCondition(ctx, inputSchemas, emulated))
+	}
+	countRows := func(c *QueryContext) string {
+		count := *c
+		if emulatedJoin(c.Joins) >= 0 {
+			count.Cols = []GenColumn{{Col: "1"}}
+			count = *WrapQueryContext(emulate(&count))
+		}
+		count.Cols = []GenColumn{{Col: "COUNT(*)"}}
+		return fmt.Sprintf("(\n%s\n)", count.SourceToSql(1))
+	}
+
+	var res []joinStatsQuery
+	for i, join := range ctx.Joins {
+		cond := joinMatchCondition(ctx, inputSchemas, i)
+
+		left := NewQueryContext()
+		left.Source = ctx.Source
+		left.JoinSourceAlias = ctx.JoinSourceAlias
+		left.Joins = ctx.Joins[:i]
+
+		right := NewQueryContext()
+		right.Source = join.Source
+		right.JoinSourceAlias = join.Alias
+
+		pairs := *left
+		pairs.Joins = append(append([]GenJoin{}, left.Joins...), GenJoin{
+			Type:      InnerJoin,
+			Source:    join.Source,
+			Alias:     join.Alias,
+			Condition: cond,
+		})
+
+		counted := []*QueryContext{
+			left,
+			withMatches(left, right, cond, true),
+			right,
+			withExists(right, emulate(matchQuery(left, cond)), true),
+			&pairs,
+		}
+		counts := make([]string, len(counted))
+		for k, c := range counted {
+			counts[k] = countRows(c)
+		}
+
+		res = append(res, joinStatsQuery{
+			Counts:         "SELECT " + strings.Join(counts, ", "),
+			LeftUnmatched:  emulate(withMatches(left, right, cond, false)).SourceToSql(0),
+			RightUnmatched: withExists(right, emulate(matchQuery(left, cond)), false).SourceToSql(0),
+		})
+	}
+
+	return res
+}
+
+// combinedColumnNames Gets every column name used by any of the inputs to a
+// Combine Rows, in the order they first appear.
+func combinedColumnNames(schemas [][]string) []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, schema := range schemas {
+		for _, col := range schema {
+			if !seen[col] {
+				seen[col] = true
+				res = append(res, col)
+			}
+		}
+	}
+	return res
+}
+
+// checkCombinedSchemas Checks that the inputs to a Combine Rows can be stacked
+// by position. Returns a message explaining the problem, if any.
+func checkCombinedSchemas(schemas [][]string, inputNums []int) string {
+	first := schemas[0]
+	for i, schema := range schemas[1:] {
+		if len(schema) != len(first) {
+			return fmt.Sprintf("Input %d has %d columns, not %d.", inputNums[i+1], len(schema), len(first))
+		}
+	}
+
+	// The same columns in a different order combine without any complaint
+	// from SQLite, but the values end up under the wrong names.
+	for i, schema := range schemas[1:] {
+		reordered := false
+		counts := map[string]int{}
+		for k, col := range schema {
+			if col != first[k] {
+				reordered = true
+			}
+			counts[col]++
+			counts[first[k]]--
+		}
+		for _, count := range counts {
+			if count != 0 {
+				reordered = false // different columns altogether, which is fine
+			}
+		}
+		if reordered {
+			return fmt.Sprintf("Columns out of order in input %d.", inputNums[i+1])
+		}
+	}
+
+	return ""
+}
+
 // CreateQuery Turns a node into a recursive context tree for SQL generation
 func (ctx *QueryContext) CreateQuery(n *Node) *QueryContext {
 	if n == nil {
@@ -276,27 +741,79 @@ func (ctx *QueryContext) CreateQuery(n *Node) *QueryContext {
 		}
 
 		for _, col := range d.Cols {
+			sortCol := col.Col
+			if col.IsExpression {
+				sortCol = strings.TrimSpace(col.Expression)
+			}
+			if sortCol == "" {
+				continue
+			}
+
 			ctx.Sorts = append(ctx.Sorts, GenSort{
-				Col:        col.Col,
+				Col:        sortCol,
 				Descending: col.Descending,
+				Nulls:      col.Nulls,
+				NoCase:     col.NoCase,
 			})
 		}
 	case *CombineRows:
-		firstCtx := NewQueryContextFromNode(n.Inputs[0])
-		firstCtx.Sorts = nil // anything involved in Combine Rows can't use ORDER BY
+		var inputs []*Node
+		for _, input := range n.Inputs {
+			if input != nil {
+				inputs = append(inputs, input)
+			}
+		}
+		if len(inputs) == 0 {
+			break
+		}
 
-		ctx = WrapQueryContext(firstCtx)
+		schemas := make([][]string, len(inputs))
+		for i, input := range inputs {
+			schemas[i] = getSchema(input)
+		}
 
-		// All other inputs get thrown into a new recursive context
-		for _, input := range n.Inputs[1:] {
-			if input != nil {
-				newCtx := NewQueryContextFromNode(input)
-				newCtx.Sorts = nil
-				ctx.Combines = append(ctx.Combines, GenCombine{
-					Context: newCtx,
-					Type:    d.CombinationType,
-				})
+		var cols []string
+		if d.MatchByName {
+			cols = combinedColumnNames(schemas)
+		}
+
+		var arms []*QueryContext
+		for i, input := range inputs {
+			arm := NewQueryContextFromNode(input)
+			arm.Sorts = nil // anything involved in Combine Rows can't use ORDER BY
+			if len(arm.CTEs) > 0 || (d.MatchByName && (len(arm.Cols) > 0 || arm.Aggregate != nil || len(arm.Combines) > 0)) {
+				// WITH can't start the second half of a compound SELECT, and
+				// the columns need to be picked on a fresh context.
+				arm = WrapQueryContext(arm)
 			}
+
+			if d.MatchByName {
+				// Columns are listed in the same order for every input, with
+				// NULLs standing in for any that are missing.
+				has := map[string]bool{}
+				for _, col := range schemas[i] {
+					has[col] = true
+				}
+				for _, col := range cols {
+					if has[col] {
+						arm.Cols = append(arm.Cols, GenColumn{Col: col})
+					} else {
+						arm.Cols = append(arm.Cols, GenColumn{Col: "NULL", Alias: col})
+					}
+				}
+			}
+
+			arms = append(arms, arm)
+		}
+
+		ctx = WrapQueryContext(arms[0])
+
+		// All other inputs get thrown into a new recursive context
+		for _, arm := range arms[1:] {
+			ctx.Combines = append(ctx.Combines, GenCombine{
+				Context: arm,
+				Type:    d.CombinationType,
+			})
 		}
 	case *Join:
 		if n.Inputs[0] == nil {
@@ -311,113 +828,238 @@ func (ctx *QueryContext) CreateQuery(n *Node) *QueryContext {
 			list of column names like "a.film_id AS a_film_id, b.film_id AS
 			b_film_id, ...".
 		*/
-		type inputSchema struct {
-			Alias       string
-			ColumnNames []string
+		var inputSchemas []joinInputSchema
+		ctx, inputSchemas = joinContext(n, d)
+
+		// Older SQLite has no RIGHT or FULL joins, so those get rewritten.
+		// Only one can be, which Join.Update warns about.
+		emulated := emulatedJoin(ctx.Joins)
+
+		cols, anyDuplicates := joinColumns(inputSchemas)
+		if anyDuplicates || emulated >= 0 {
+			ctx.Cols = cols
 		}
-		var inputSchemas []inputSchema
 
-		if table, ok := n.Inputs[0].Data.(*Table); ok {
-			ctx = NewQueryContext()
-			ctx.Source = table
-		} else {
-			firstCtx := NewQueryContextFromNode(n.Inputs[0])
-			ctx = WrapQueryContext(firstCtx)
+		if emulated >= 0 {
+			cond := joinMatchCondition(ctx, inputSchemas, emulated)
+			ctx = emulateOuterJoin(ctx, emulated, cond)
+		}
+	case *Aggregate:
+		ctx = ctx.CreateQuery(n.Inputs[0])
+		if len(ctx.Cols) > 0 || ctx.Aggregate != nil {
+			ctx = WrapQueryContext(ctx)
 		}
 
-		ctx.JoinSourceAlias = d.FirstAlias
-		inputSchemas = append(inputSchemas, inputSchema{
-			Alias:       d.FirstAlias,
-			ColumnNames: getSchema(n.Inputs[0]),
-		})
+		groupByCols := make([]string, len(d.GroupBys))
+		for i, gb := range d.GroupBys {
+			groupByCols[i] = gb.Col
+		}
 
-		// All other inputs get thrown into a new recursive context
-		for i, input := range n.Inputs[1:] {
-			if input == nil {
-				continue
+		aggs := make([]GenAggregateEntry, len(d.Aggregates))
+		for i, agg := range d.Aggregates {
+			aggs[i] = GenAggregateEntry{
+				Type:   agg.Type,
+				Col:    agg.Col,
+				Arg:    agg.ArgSql(),
+				Alias:  agg.Alias,
+				Filter: agg.Filter,
 			}
+		}
 
-			alias := d.Conditions[i].Alias
+		ctx.Aggregate = &GenAggregate{
+			GroupByCols: groupByCols,
+			Aggs:        aggs,
+		}
+		if d.CanHave() && strings.TrimSpace(d.Having) != "" {
+			ctx.HavingConditions = append(ctx.HavingConditions, d.Having)
+		}
+	case *Cleanup:
+		ctx = ctx.CreateQuery(n.Inputs[0])
+		if n.Inputs[0] == nil {
+			break
+		}
+		if len(ctx.Cols) > 0 || ctx.Aggregate != nil {
+			ctx = WrapQueryContext(ctx)
+		}
 
-			inputSchemas = append(inputSchemas, inputSchema{
-				Alias:       alias,
-				ColumnNames: getSchema(input),
-			})
+		for _, col := range getSchema(n.Inputs[0]) {
+			expr := d.ColumnExpression(col)
 
-			var source SqlSource
-			if table, ok := input.Data.(*Table); ok {
-				source = table
-			} else {
-				source = NewQueryContextFromNode(input)
+			alias := ""
+			if expr != col {
+				alias = col
 			}
 
-			cond := d.Conditions[i]
-			ctx.Joins = append(ctx.Joins, GenJoin{
-				Source:    source,
-				Condition: cond.Condition,
-				Type:      cond.Type(),
-				Alias:     alias,
+			ctx.Cols = append(ctx.Cols, GenColumn{
+				Col:   expr,
+				Alias: alias,
 			})
 		}
+	case *TopN:
+		ctx = ctx.CreateQuery(n.Inputs[0])
+		if n.Inputs[0] == nil || d.OrderCol == "" {
+			break
+		}
 
-		colCounts := map[string]int{}
-		for _, schema := range inputSchemas {
-			for _, col := range schema.ColumnNames {
-				current, _ := colCounts[col]
-				colCounts[col] = current + 1
-			}
+		/*
+			Rows are numbered within each group by a window function in a
+			subquery, and the outer query keeps the first N of each. The
+			outer query lists the input columns explicitly so the row number
+			doesn't leak into our schema.
+		*/
+		if len(ctx.Cols) > 0 || ctx.Aggregate != nil {
+			ctx = WrapQueryContext(ctx)
 		}
+		ctx.Cols = append(ctx.Cols,
+			GenColumn{Col: "*"},
+			GenColumn{Col: d.RankExpression(), Alias: topNRankCol},
+		)
 
-		anyDuplicates := false
-		for _, count := range colCounts {
-			if count > 1 {
-				anyDuplicates = true
-				break
+		ctx = WrapQueryContext(ctx)
+		for _, col := range getSchema(n.Inputs[0]) {
+			ctx.Cols = append(ctx.Cols, GenColumn{Col: col})
+		}
+		ctx.WhereConditions = append(ctx.WhereConditions, fmt.Sprintf("%s <= %d", topNRankCol, d.N()))
+		for _, gb := range d.GroupBys {
+			if gb.Col != "" {
+				ctx.Sorts = append(ctx.Sorts, GenSort{Col: gb.Col})
 			}
 		}
+		ctx.Sorts = append(ctx.Sorts, GenSort{Col: topNRankCol})
+	case *Hierarchy:
+		if n.Inputs[0] == nil || d.IdCol == "" || d.ParentCol == "" {
+			ctx = ctx.CreateQuery(n.Inputs[0])
+			break
+		}
 
-		if anyDuplicates {
-			for _, schema := range inputSchemas {
-				for _, col := range schema.ColumnNames {
-					specificCol := fmt.Sprintf("%s.%s", schema.Alias, col)
+		/*
+			The input goes in its own CTE so the recursive step can join back
+			to it. Roots get depth 0 and a path of just their id; every
+			other row is found by joining on the previous level.
 
-					alias := ""
-					if colCounts[col] > 1 {
-						alias = fmt.Sprintf("%s_%s", schema.Alias, col)
-					}
+				WITH RECURSIVE hierarchy_src AS (...), hierarchy AS (
+					SELECT src.*, 0 AS depth, ... WHERE <roots>
+					UNION ALL
+					SELECT src.*, h.depth + 1, ... JOIN hierarchy AS h ON ...
+				)
+				SELECT * FROM hierarchy
+		*/
+		srcTable := &Table{Table: hierarchySourceName}
 
-					ctx.Cols = append(ctx.Cols, GenColumn{
-						Col:   specificCol,
-						Alias: alias,
-					})
-				}
-			}
+		anchor := NewQueryContext()
+		anchor.Source = srcTable
+		anchor.JoinSourceAlias = "src"
+		anchor.Cols = []GenColumn{
+			{Col: "src.*"},
+			{Col: "0", Alias: hierarchyDepthCol},
+			{Col: fmt.Sprintf("CAST(src.%s AS TEXT)", d.IdCol), Alias: hierarchyPathCol},
 		}
-	case *Aggregate:
+		anchor.WhereConditions = []string{d.RootCondition()}
+
+		step := NewQueryContext()
+		step.Source = srcTable
+		step.JoinSourceAlias = "src"
+		step.Cols = []GenColumn{
+			{Col: "src.*"},
+			{Col: fmt.Sprintf("h.%s + 1", hierarchyDepthCol)},
+			{Col: fmt.Sprintf("h.%s || '/' || src.%s", hierarchyPathCol, d.IdCol)},
+		}
+		step.Joins = []GenJoin{{
+			Type:      InnerJoin,
+			Source:    &Table{Table: hierarchyName},
+			Alias:     "h",
+			Condition: fmt.Sprintf("src.%s = h.%s", d.ParentCol, d.IdCol),
+		}}
+		step.WhereConditions = []string{fmt.Sprintf("h.%s < %d", hierarchyDepthCol, hierarchyMaxDepth)}
+
+		recursive := WrapQueryContext(anchor)
+		recursive.Combines = []GenCombine{{Context: step, Type: UnionAll}}
+
+		ctx = NewQueryContext()
+		ctx.CTEs = []GenCTE{
+			{Name: hierarchySourceName, Source: NewQueryContextFromNode(n.Inputs[0])},
+			{Name: hierarchyName, Source: recursive},
+		}
+		ctx.RecursiveCTEs = true
+		ctx.Source = &Table{Table: hierarchyName}
+	case *ExtractJSON:
 		ctx = ctx.CreateQuery(n.Inputs[0])
-		if len(ctx.Cols) > 0 || ctx.Aggregate != nil {
+		if n.Inputs[0] == nil || d.Col == "" {
+			break
+		}
+
+		/*
+			The input is aliased as src so the extracted columns can't be
+			confused with json_each()'s own columns (key, value, id, ...).
+			A bare table can be aliased directly; anything else becomes a
+			subquery.
+
+				SELECT src.*, CAST(json_extract(src.col, '$.a') AS INTEGER) AS a
+				FROM (...) AS src
+				JOIN json_each(src.col, '$.items') AS je
+		*/
+		bareTable := ctx.Source != nil && ctx.Source.IsTable() &&
+			len(ctx.Cols) == 0 && ctx.Aggregate == nil && len(ctx.Joins) == 0 &&
+			ctx.JoinSourceAlias == "" && len(ctx.WhereConditions) == 0 && len(ctx.Sorts) == 0
+		if !bareTable {
 			ctx = WrapQueryContext(ctx)
 		}
+		ctx.JoinSourceAlias = "src"
 
-		groupByCols := make([]string, len(d.GroupBys))
-		for i, gb := range d.GroupBys {
-			groupByCols[i] = gb.Col
+		ctx.Cols = append(ctx.Cols, GenColumn{Col: "src.*"})
+		ctx.Cols = append(ctx.Cols, d.Columns(getSchema(n.Inputs[0]))...)
+
+		if d.Explode != "" {
+			ctx.Joins = append(ctx.Joins, GenJoin{
+				Type:   InnerJoin,
+				Source: &Table{Table: d.ExplodeSource()},
+				Alias:  jsonEachAlias,
+			})
+		}
+	case *Search:
+		if n.Inputs[0] == nil || d.Col == "" {
+			ctx = ctx.CreateQuery(n.Inputs[0])
+			break
 		}
 
-		aggs := make([]GenAggregateEntry, len(d.Aggregates))
-		for i, agg := range d.Aggregates {
-			aggs[i] = GenAggregateEntry{
-				Type:  agg.Type,
-				Col:   agg.Col,
-				Alias: agg.Alias,
-			}
+		// Search.Update builds the index. Until it has, the input passes
+		// through unsearched.
+		inputSchema := getSchema(n.Inputs[0])
+		index := searchIndexName(NewQueryContextFromNode(n.Inputs[0]).SourceToSql(0), d.Col)
+		if !searchIndexBuilt(index) {
+			ctx = ctx.CreateQuery(n.Inputs[0])
+			break
 		}
 
-		ctx.Aggregate = &GenAggregate{
-			GroupByCols: groupByCols,
-			Aggs:        aggs,
+		// Results come straight out of the index, best matches first.
+		ctx = NewQueryContext()
+		ctx.Source = &Table{Table: index}
+		for _, col := range inputSchema {
+			ctx.Cols = append(ctx.Cols, GenColumn{Col: col})
+		}
+		ctx.Cols = append(ctx.Cols, GenColumn{Col: searchRankCol})
+		if query := d.MatchQuery(); query != "" {
+			ctx.WhereConditions = append(ctx.WhereConditions, fmt.Sprintf(
+				"%s MATCH '%s'", index, strings.ReplaceAll(query, "'", "''"),
+			))
+			ctx.Sorts = append(ctx.Sorts, GenSort{Col: searchRankCol})
+		}
+	case *Chart:
+		ctx = ctx.CreateQuery(n.Inputs[0])
+		if condition := d.SelectionCondition(); condition != "" {
+			// Older SQLite only allows HAVING with a GROUP BY, so totals
+			// over everything get filtered from the outside.
+			if len(ctx.Cols) > 0 || (ctx.Aggregate != nil && len(ctx.Aggregate.GroupByCols) == 0) {
+				ctx = WrapQueryContext(ctx)
+			}
+
+			if ctx.Aggregate != nil {
+				ctx.HavingConditions = append(ctx.HavingConditions, condition)
+			} else {
+				ctx.WhereConditions = append(ctx.WhereConditions, condition)
+			}
 		}
-	case *Preview, *Chart:
+	case *Preview, *Distribution, *Pivot, *SaveTable, *Export:
 		ctx = ctx.CreateQuery(n.Inputs[0])
 	}
 
@@ -440,3 +1082,50 @@ func (n *Node) GenerateSql(limit bool) string {
 	}
 	return sql
 }
+
+// sqlValueLiteral Turns a value that came out of a query back into an SQL
+// literal that will match it.
+func sqlValueLiteral(v interface{}) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return quote(val.Format("2006-01-02 15:04:05"))
+	case []byte:
+		if utf8.Valid(val) {
+			return quote(string(val))
+		}
+		return fmt.Sprintf("X'%X'", val)
+	default:
+		return quote(fmt.Sprintf("%v", val))
+	}
+}
+
+// sqlLiteral Turns a constant typed by the user into an SQL literal. Numbers,
+// NULL, and already-quoted strings are left alone; anything else is quoted.
+func sqlLiteral(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "NULL") {
+		return "NULL"
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
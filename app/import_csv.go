@@ -0,0 +1,540 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/bvisness/SQLJam/raygui"
+)
+
+type CSVEncoding int
+
+const (
+	EncodingAuto CSVEncoding = iota + 1
+	EncodingUTF8
+	EncodingUTF16LE
+	EncodingUTF16BE
+	EncodingLatin1
+	EncodingWindows1252
+)
+
+var csvEncodingOpts = []raygui.DropdownExOption{
+	{"Auto", EncodingAuto},
+	{"UTF-8", EncodingUTF8},
+	{"UTF-16 LE", EncodingUTF16LE},
+	{"UTF-16 BE", EncodingUTF16BE},
+	{"Latin-1", EncodingLatin1},
+	{"Windows-1252", EncodingWindows1252},
+}
+
+type CSVImportOptions struct {
+	Table    string
+	Temp     bool
+	Header   bool
+	Encoding CSVEncoding
+}
+
+// How many records to look at when guessing column types.
+const csvSampleRecords = 1000
+
+// CSVImport tracks an import running in the background. The UI polls it
+// every frame.
+type CSVImport struct {
+	lock      sync.Mutex
+	bytesRead int64
+	totalSize int64
+	rows      int
+	done      bool
+	err       error
+}
+
+// Progress Gets the fraction of the file read so far, the number of rows
+// inserted, and whether the import has finished (and if so, whether it
+// failed).
+func (imp *CSVImport) Progress() (frac float32, rows int, done bool, err error) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+
+	if imp.totalSize > 0 {
+		frac = float32(imp.bytesRead) / float32(imp.totalSize)
+	}
+	return frac, imp.rows, imp.done, imp.err
+}
+
+func (imp *CSVImport) setProgress(bytesRead int64, rows int) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	imp.bytesRead = bytesRead
+	imp.rows = rows
+}
+
+func (imp *CSVImport) finish(err error) {
+	imp.lock.Lock()
+	defer imp.lock.Unlock()
+	imp.done = true
+	imp.err = err
+}
+
+// Starts importing a CSV file into a new table. The import runs in its own
+// goroutine, committing as it goes.
+func startCSVImport(path string, opts CSVImportOptions) *CSVImport {
+	imp := &CSVImport{}
+	go func() {
+		imp.finish(importCSV(imp, path, opts))
+	}()
+	return imp
+}
+
+func importCSV(imp *CSVImport, path string, opts CSVImportOptions) error {
+	if err := validateTableName(opts.Table); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	imp.lock.Lock()
+	imp.totalSize = info.Size()
+	imp.lock.Unlock()
+
+	// Sniff the encoding and delimiter from the start of the file.
+	head := make([]byte, 64*1024)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+
+	encoding, bomLen := detectCSVEncoding(head, opts.Encoding)
+	decodedHead, err := io.ReadAll(newDecodingReader(bytes.NewReader(head[bomLen:]), encoding))
+	if err != nil {
+		return err
+	}
+	delimiter := detectCSVDelimiter(decodedHead)
+
+	// First pass: column names and types from a sample of the file
+	if _, err := f.Seek(int64(bomLen), io.SeekStart); err != nil {
+		return err
+	}
+	sampleReader := newCSVReader(newDecodingReader(f, encoding), delimiter)
+	var sample [][]string
+	for len(sample) < csvSampleRecords {
+		record, err := sampleReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		sample = append(sample, record)
+	}
+	if len(sample) == 0 {
+		return errors.New("The file is empty.")
+	}
+
+	var names []string
+	if opts.Header {
+		names = csvColumnNames(sample[0])
+		sample = sample[1:]
+	} else {
+		names = csvColumnNames(make([]string, len(sample[0])))
+	}
+	types := inferCSVColumnTypes(sample, len(names))
+
+	// Second pass: stream every record into the new table
+	if _, err := f.Seek(int64(bomLen), io.SeekStart); err != nil {
+		return err
+	}
+	counter := &countingReader{r: f, n: int64(bomLen)}
+	reader := newCSVReader(newDecodingReader(counter, encoding), delimiter)
+	reader.ReuseRecord = true
+
+	// TEMP tables only show up on the connection that made them, so those
+	// have to go through the UI's.
+	conn, qualifiedName, create := bgDB, opts.Table, "CREATE TABLE"
+	if opts.Temp {
+		conn, qualifiedName, create = db, "temp."+opts.Table, "CREATE TEMP TABLE"
+	}
+	colDefs := make([]string, len(names))
+	placeholders := make([]string, len(names))
+	for i := range names {
+		colDefs[i] = fmt.Sprintf("%s %s", names[i], types[i])
+		placeholders[i] = "?"
+	}
+	if _, err := conn.Exec(fmt.Sprintf("%s %s (%s)", create, opts.Table, strings.Join(colDefs, ", "))); err != nil {
+		return err
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s VALUES (%s)", qualifiedName, strings.Join(placeholders, ", "))
+	rows, err := insertCSVRecords(imp, conn, insert, reader, counter, len(names), opts.Header)
+	if err != nil {
+		// Don't leave half a table behind.
+		if _, dropErr := conn.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", qualifiedName)); dropErr != nil {
+			log.Print(dropErr)
+		}
+		return err
+	}
+	imp.setProgress(info.Size(), rows)
+
+	return nil
+}
+
+// How many rows go in each transaction. Committing along the way lets other
+// queries in between, where one big transaction would hold them all up.
+const csvBatchRows = 1000
+
+// Streams the records into the table, committing every csvBatchRows rows.
+// Returns the number of rows inserted.
+func insertCSVRecords(imp *CSVImport, conn *sql.DB, insert string, reader *csv.Reader, counter *countingReader, numCols int, header bool) (int, error) {
+	var tx *sql.Tx
+	var stmt *sql.Stmt
+	defer func() {
+		if tx != nil {
+			stmt.Close()
+			tx.Rollback()
+		}
+	}()
+	commit := func() error {
+		stmt.Close()
+		err := tx.Commit()
+		tx, stmt = nil, nil
+		return err
+	}
+
+	values := make([]interface{}, numCols)
+	rows := 0
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return rows, err
+		}
+		if first && header {
+			continue
+		}
+
+		if tx == nil {
+			if tx, err = conn.Begin(); err != nil {
+				return rows, err
+			}
+			if stmt, err = tx.Prepare(insert); err != nil {
+				tx.Rollback()
+				tx = nil
+				return rows, err
+			}
+		}
+
+		// Ragged rows get padded with NULLs or cut short.
+		for i := range values {
+			values[i] = nil
+			if i < len(record) && record[i] != "" {
+				values[i] = record[i]
+			}
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return rows, err
+		}
+
+		rows++
+		if rows%csvBatchRows == 0 {
+			if err := commit(); err != nil {
+				return rows, err
+			}
+			imp.setProgress(counter.Count(), rows)
+		}
+	}
+
+	if tx != nil {
+		if err := commit(); err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+func newCSVReader(r io.Reader, delimiter rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader
+}
+
+var nonIdentifierRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Every keyword SQLite knows. Many of them can't be used as names without
+// quotes, and generated SQL never quotes names, so they're avoided entirely.
+var sqliteKeywords = map[string]bool{
+	"ABORT": true, "ACTION": true, "ADD": true, "AFTER": true, "ALL": true,
+	"ALTER": true, "ALWAYS": true, "ANALYZE": true, "AND": true, "AS": true,
+	"ASC": true, "ATTACH": true, "AUTOINCREMENT": true, "BEFORE": true,
+	"BEGIN": true, "BETWEEN": true, "BY": true, "CASCADE": true, "CASE": true,
+	"CAST": true, "CHECK": true, "COLLATE": true, "COLUMN": true,
+	"COMMIT": true, "CONFLICT": true, "CONSTRAINT": true, "CREATE": true,
+	"CROSS": true, "CURRENT": true, "CURRENT_DATE": true, "CURRENT_TIME": true,
+	"CURRENT_TIMESTAMP": true, "DATABASE": true, "DEFAULT": true,
+	"DEFERRABLE": true, "DEFERRED": true, "DELETE": true, "DESC": true,
+	"DETACH": true, "DISTINCT": true, "DO": true, "DROP": true, "EACH": true,
+	"ELSE": true, "END": true, "ESCAPE": true, "EXCEPT": true, "EXCLUDE": true,
+	"EXCLUSIVE": true, "EXISTS": true, "EXPLAIN": true, "FAIL": true,
+	"FILTER": true, "FIRST": true, "FOLLOWING": true, "FOR": true,
+	"FOREIGN": true, "FROM": true, "FULL": true, "GENERATED": true,
+	"GLOB": true, "GROUP": true, "GROUPS": true, "HAVING": true, "IF": true,
+	"IGNORE": true, "IMMEDIATE": true, "IN": true, "INDEX": true,
+	"INDEXED": true, "INITIALLY": true, "INNER": true, "INSERT": true,
+	"INSTEAD": true, "INTERSECT": true, "INTO": true, "IS": true,
+	"ISNULL": true, "JOIN": true, "KEY": true, "LAST": true, "LEFT": true,
+	"LIKE": true, "LIMIT": true, "MATCH": true, "MATERIALIZED": true,
+	"NATURAL": true, "NO": true, "NOT": true, "NOTHING": true, "NOTNULL": true,
+	"NULL": true, "NULLS": true, "OF": true, "OFFSET": true, "ON": true,
+	"OR": true, "ORDER": true, "OTHERS": true, "OUTER": true, "OVER": true,
+	"PARTITION": true, "PLAN": true, "PRAGMA": true, "PRECEDING": true,
+	"PRIMARY": true, "QUERY": true, "RAISE": true, "RANGE": true,
+	"RECURSIVE": true, "REFERENCES": true, "REGEXP": true, "REINDEX": true,
+	"RELEASE": true, "RENAME": true, "REPLACE": true, "RESTRICT": true,
+	"RETURNING": true, "RIGHT": true, "ROLLBACK": true, "ROW": true,
+	"ROWS": true, "SAVEPOINT": true, "SELECT": true, "SET": true, "TABLE": true,
+	"TEMP": true, "TEMPORARY": true, "THEN": true, "TIES": true, "TO": true,
+	"TRANSACTION": true, "TRIGGER": true, "UNBOUNDED": true, "UNION": true,
+	"UNIQUE": true, "UPDATE": true, "USING": true, "VACUUM": true,
+	"VALUES": true, "VIEW": true, "VIRTUAL": true, "WHEN": true, "WHERE": true,
+	"WINDOW": true, "WITH": true, "WITHOUT": true,
+}
+
+func isSQLiteKeyword(name string) bool {
+	return sqliteKeywords[strings.ToUpper(name)]
+}
+
+// Turns header values into usable, unique column names. Generated SQL doesn't
+// quote identifiers, so anything unusual gets replaced, and keywords get a _
+// on the end.
+func csvColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	used := map[string]bool{}
+	for i, h := range header {
+		name := strings.Trim(nonIdentifierRegexp.ReplaceAllString(strings.TrimSpace(h), "_"), "_")
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		} else if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		if isSQLiteKeyword(name) {
+			name += "_"
+		}
+
+		unique := name
+		for suffix := 2; used[strings.ToLower(unique)]; suffix++ {
+			unique = fmt.Sprintf("%s_%d", name, suffix)
+		}
+		used[strings.ToLower(unique)] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// Picks INTEGER, REAL, or TEXT for each column based on the sampled values.
+// Empty values don't count against a type, since they become NULL.
+func inferCSVColumnTypes(sample [][]string, numCols int) []string {
+	types := make([]string, numCols)
+	for col := range types {
+		isInt, isReal, any := true, true, false
+		for _, record := range sample {
+			if col >= len(record) || record[col] == "" {
+				continue
+			}
+			any = true
+			v := strings.TrimSpace(record[col])
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				isInt = false
+			}
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				isReal = false
+			}
+		}
+
+		switch {
+		case any && isInt:
+			types[col] = "INTEGER"
+		case any && isReal:
+			types[col] = "REAL"
+		default:
+			types[col] = "TEXT"
+		}
+	}
+	return types
+}
+
+// Guesses the delimiter by seeing which candidate shows up the most in the
+// first line.
+func detectCSVDelimiter(head []byte) rune {
+	firstLine := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		firstLine = head[:i]
+	}
+
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{',', ';', '\t', '|'} {
+		if count := bytes.Count(firstLine, []byte(string(candidate))); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+// Resolves the encoding to use, checking for a byte order mark. Returns the
+// length of the BOM so it can be skipped.
+func detectCSVEncoding(head []byte, requested CSVEncoding) (CSVEncoding, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		if requested == EncodingAuto || requested == EncodingUTF8 {
+			return EncodingUTF8, 3
+		}
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		if requested == EncodingAuto || requested == EncodingUTF16LE {
+			return EncodingUTF16LE, 2
+		}
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		if requested == EncodingAuto || requested == EncodingUTF16BE {
+			return EncodingUTF16BE, 2
+		}
+	}
+
+	if requested != EncodingAuto {
+		return requested, 0
+	}
+
+	// No BOM; anything that isn't valid UTF-8 is most likely from Excel on
+	// Windows. Don't let a character cut off at the end of the sample count.
+	sample := head
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(sample) {
+		return EncodingUTF8, 0
+	}
+	return EncodingWindows1252, 0
+}
+
+type countingReader struct {
+	lock sync.Mutex
+	r    io.Reader
+	n    int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.lock.Lock()
+	c.n += int64(n)
+	c.lock.Unlock()
+	return n, err
+}
+
+func (c *countingReader) Count() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.n
+}
+
+// Converts text in the given encoding to UTF-8 as it's read.
+func newDecodingReader(r io.Reader, encoding CSVEncoding) io.Reader {
+	switch encoding {
+	case EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1, EncodingWindows1252:
+		return &decodingReader{src: bufio.NewReader(r), encoding: encoding}
+	default:
+		return r
+	}
+}
+
+type decodingReader struct {
+	src      *bufio.Reader
+	encoding CSVEncoding
+	pending  []byte // decoded bytes that didn't fit in the last Read
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	for len(d.pending) < len(p) {
+		r, err := d.nextRune()
+		if err != nil {
+			if len(d.pending) == 0 {
+				return 0, err
+			}
+			break
+		}
+		var buf [utf8.UTFMax]byte
+		d.pending = append(d.pending, buf[:utf8.EncodeRune(buf[:], r)]...)
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func (d *decodingReader) nextRune() (rune, error) {
+	switch d.encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		r1, err := d.nextUnit()
+		if err != nil {
+			return 0, err
+		}
+		if !utf16.IsSurrogate(r1) {
+			return r1, nil
+		}
+		r2, err := d.nextUnit()
+		if err != nil {
+			return utf8.RuneError, nil
+		}
+		return utf16.DecodeRune(r1, r2), nil
+	default:
+		b, err := d.src.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if d.encoding == EncodingWindows1252 && b >= 0x80 && b < 0xA0 {
+			return windows1252High[b-0x80], nil
+		}
+		return rune(b), nil // Latin-1 maps straight onto Unicode
+	}
+}
+
+func (d *decodingReader) nextUnit() (rune, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(d.src, b[:]); err != nil {
+		return 0, err
+	}
+	if d.encoding == EncodingUTF16LE {
+		return rune(b[0]) | rune(b[1])<<8, nil
+	}
+	return rune(b[0])<<8 | rune(b[1]), nil
+}
+
+// The characters Windows-1252 puts in 0x80-0x9F, where Latin-1 has control
+// codes.
+var windows1252High = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"regexp"
+	"sync"
+)
+
+// JoinStats How the rows on the two sides of a join matched up. The left side
+// is everything joined before it.
+type JoinStats struct {
+	LeftRows     int64
+	LeftMatched  int64
+	RightRows    int64
+	RightMatched int64
+	Pairs        int64 // the number of rows an inner join produces
+
+	LeftUnmatchedSql  string
+	RightUnmatchedSql string
+}
+
+// LeftFanOut How many times each matched row on the left shows up in the
+// output, on average. Anything over 1 means the join multiplied rows.
+func (s *JoinStats) LeftFanOut() float64 {
+	if s.LeftMatched == 0 {
+		return 1
+	}
+	return float64(s.Pairs) / float64(s.LeftMatched)
+}
+
+// RightFanOut The same as LeftFanOut, but for the right side.
+func (s *JoinStats) RightFanOut() float64 {
+	if s.RightMatched == 0 {
+		return 1
+	}
+	return float64(s.Pairs) / float64(s.RightMatched)
+}
+
+// JoinStatsJob Counts join matches in the background, since the counts can
+// take a while on big tables.
+type JoinStatsJob struct {
+	cancel context.CancelFunc
+
+	lock  sync.Mutex
+	stats []*JoinStats
+	done  bool
+	err   error
+}
+
+// joinStatsConn Picks the connection to count on. TEMP tables only exist on
+// the UI's connection, so queries that use one have to be counted there, even
+// though that holds up the UI. Everything else is counted in the background.
+func joinStatsConn(queries []joinStatsQuery) *sql.DB {
+	rows, err := db.Query(`
+		SELECT name FROM sqlite_temp_master
+		WHERE type IN ('table', 'view')
+	`)
+	if err != nil {
+		log.Print(err)
+		return db
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Print(err)
+			return db
+		}
+
+		usesName := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+		for _, q := range queries {
+			if usesName.MatchString(q.Counts) {
+				return db
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		return db
+	}
+
+	return bgDB
+}
+
+func startJoinStats(queries []joinStatsQuery, conn *sql.DB) *JoinStatsJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &JoinStatsJob{cancel: cancel}
+
+	go func() {
+		for _, q := range queries {
+			stats := &JoinStats{
+				LeftUnmatchedSql:  q.LeftUnmatched,
+				RightUnmatchedSql: q.RightUnmatched,
+			}
+			err := conn.QueryRowContext(ctx, q.Counts).Scan(
+				&stats.LeftRows, &stats.LeftMatched,
+				&stats.RightRows, &stats.RightMatched,
+				&stats.Pairs,
+			)
+
+			job.lock.Lock()
+			if err != nil {
+				job.err = err
+			} else {
+				job.stats = append(job.stats, stats)
+			}
+			job.lock.Unlock()
+
+			if err != nil {
+				break
+			}
+		}
+
+		job.lock.Lock()
+		job.done = true
+		job.lock.Unlock()
+	}()
+
+	return job
+}
+
+// Result Gets the stats counted so far, one per join. If counting failed,
+// there will be fewer stats than joins.
+func (j *JoinStatsJob) Result() (stats []*JoinStats, done bool, err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.stats, j.done, j.err
+}
+
+// Cancel Stops counting. Used when the join changes and the counts are out of
+// date.
+func (j *JoinStatsJob) Cancel() {
+	j.cancel()
+}
@@ -85,6 +85,15 @@ func UpdateInspectorIfNeeded() {
 	inspectorDirty = false
 }
 
+// ShowQueryInInspector Shows the results of a query that doesn't belong to any
+// node, like the rows a join left out.
+func ShowQueryInInspector(sql string) {
+	currentSQL = sql
+	resultsOpen = true
+	latestResults.Update(doQuery(sql + " LIMIT 1000"))
+	inspectorDirty = false
+}
+
 func Main() {
 	rl.SetConfigFlags(rl.FlagWindowResizable)
 	rl.InitWindow(int32(screenWidth), int32(screenHeight), "SQL Jam")
@@ -150,6 +159,8 @@ func doFrame() {
 	didCaptureScrollThisFrame = false
 
 	DoPane(rl.Rectangle{0, 0, screenWidth, screenHeight - resultsCurrentHeight}, func(p Pane) {
+		handleDroppedFiles()
+
 		// update nodes
 		for _, n := range nodes {
 			n.UISize = rl.Vector2{}
@@ -373,6 +384,10 @@ func drawCurrentSQL() {
 
 			}
 
+			if closer, ok := selectedNode.Data.(NodeCloser); ok {
+				closer.Close()
+			}
+
 			selectedNode = nil
 			resultsOpen = false
 		}
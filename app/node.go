@@ -33,7 +33,8 @@ type Node struct {
 	UIRect         rl.Rectangle // the UI content area
 
 	// Schema / codegen properties
-	Schema []string
+	Schema      []string
+	ColumnKinds map[string]ColumnKind
 }
 
 type NodeData interface {
@@ -42,6 +43,12 @@ type NodeData interface {
 	Serialize() (res string, active bool)
 }
 
+// NodeCloser Node data that holds on to something outside the node, like a
+// TEMP table, which has to be let go of when the node is deleted.
+type NodeCloser interface {
+	Close()
+}
+
 func (n *Node) Rect() rl.Rectangle {
 	return rl.Rectangle{n.Pos.X, n.Pos.Y, n.Size.X, n.Size.Y}
 }
@@ -50,6 +57,7 @@ func clearAllSchemas() {
 	fmt.Println("cleared")
 	for _, n := range nodes {
 		n.Schema = nil
+		n.ColumnKinds = nil
 	}
 }
 
@@ -2,6 +2,8 @@ package app
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -12,15 +14,22 @@ var AggregateColor = rl.NewColor(182, 213, 60, 255)
 type Aggregate struct {
 	Aggregates []*AggregateColumn
 	GroupBys   []*AggregateGroupBy
+	Having     string
+
+	HavingTextbox raygui.TextBoxEx
 }
 
 type AggregateColumn struct {
-	Type         AggregateType
-	Col          string
-	Alias        string
-	TypeDropdown raygui.DropdownEx
-	ColDropdown  raygui.DropdownEx
-	AliasTextbox raygui.TextBoxEx
+	Type          AggregateType
+	Col           string
+	Arg           string // the percent for PERCENTILE, or the separator for GROUP_CONCAT
+	Alias         string
+	Filter        string // only these rows are aggregated
+	TypeDropdown  raygui.DropdownEx
+	ColDropdown   raygui.DropdownEx
+	ArgTextbox    raygui.TextBoxEx
+	AliasTextbox  raygui.TextBoxEx
+	FilterTextbox raygui.TextBoxEx
 }
 
 type AggregateGroupBy struct {
@@ -37,8 +46,55 @@ const (
 	Sum
 	Count
 	CountDistinct
+
+	// Not built into SQLite; see functions.go.
+	Median
+	Percentile
+	StdDev
+	Variance
+
+	GroupConcat
+	Total
+	CountAll
+	SumDistinct
+	AvgDistinct
 )
 
+// HasCol Whether the aggregate uses a column at all.
+func (t AggregateType) HasCol() bool {
+	return t != CountAll
+}
+
+// HasArg Whether the aggregate takes a second argument besides the column.
+func (t AggregateType) HasArg() bool {
+	return t == Percentile || t == GroupConcat
+}
+
+// ArgSql Gets the second argument as SQL: the percent for PERCENTILE
+// (defaulting to 50), or the quoted separator for GROUP_CONCAT (defaulting
+// to a comma).
+func (agg *AggregateColumn) ArgSql() string {
+	switch agg.Type {
+	case Percentile:
+		arg := strings.TrimSpace(agg.Arg)
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return "50"
+		}
+		return arg
+	case GroupConcat:
+		if agg.Arg == "" {
+			return "','"
+		}
+		// Spaces matter in a separator, so unlike sqlLiteral this doesn't trim.
+		if len(agg.Arg) >= 2 && strings.HasPrefix(agg.Arg, "'") && strings.HasSuffix(agg.Arg, "'") {
+			return agg.Arg
+		}
+		return "'" + strings.ReplaceAll(agg.Arg, "'", "''") + "'"
+	default:
+		return ""
+	}
+}
+
 func NewAggregate() *Node {
 	return &Node{
 		Title:   "Aggregate",
@@ -51,6 +107,12 @@ func NewAggregate() *Node {
 	}
 }
 
+// CanHave Whether the Having condition applies, which it only does when
+// grouping.
+func (d *Aggregate) CanHave() bool {
+	return len(d.GroupBys) > 0
+}
+
 func (d *Aggregate) AllDropdowns() []*raygui.DropdownEx {
 	res := make([]*raygui.DropdownEx, 0, 2*len(d.Aggregates)+len(d.GroupBys))
 	for _, agg := range d.Aggregates {
@@ -65,19 +127,28 @@ func (d *Aggregate) AllDropdowns() []*raygui.DropdownEx {
 
 var aggregateTypeOpts = []raygui.DropdownExOption{
 	{"AVG", Avg},
+	{"AVG DISTINCT", AvgDistinct},
 	{"MAX", Max},
 	{"MIN", Min},
 	{"SUM", Sum},
+	{"SUM DISTINCT", SumDistinct},
+	{"TOTAL", Total},
 	{"COUNT", Count},
 	{"COUNT DISTINCT", CountDistinct},
+	{"COUNT(*)", CountAll},
+	{"GROUP_CONCAT", GroupConcat},
+	{"MEDIAN", Median},
+	{"PERCENTILE", Percentile},
+	{"STDDEV", StdDev},
+	{"VARIANCE", Variance},
 }
 
 func (d *Aggregate) Update(n *Node) {
 	height := 0
 
-	// Aggregated columns
+	// Aggregated columns, each with a filter row
 	for range d.Aggregates {
-		height += UIFieldHeight + UIFieldSpacing
+		height += 2 * (UIFieldHeight + UIFieldSpacing)
 	}
 	height += UIFieldHeight + UIFieldSpacing // for +/- buttons
 
@@ -86,7 +157,9 @@ func (d *Aggregate) Update(n *Node) {
 	for range d.GroupBys {
 		height += UIFieldHeight + UIFieldSpacing // for group by rows
 	}
-	height += UIFieldHeight // for +/- buttons
+	height += UIFieldHeight + UIFieldSpacing // for +/- buttons
+
+	height += UIFieldHeight // for having
 	height = int(float64(height) * zoomLevel)
 
 	n.UISize = rl.Vector2{600, float32(height)}
@@ -103,6 +176,7 @@ func (d *Aggregate) Update(n *Node) {
 
 func (d *Aggregate) DoUI(n *Node) {
 	const typeWidth = 200 * zoomLevel
+	const argWidth = 70 * zoomLevel
 
 	openDropdown, isOpen := raygui.GetOpenDropdown(d.AllDropdowns())
 	if isOpen {
@@ -110,12 +184,30 @@ func (d *Aggregate) DoUI(n *Node) {
 		defer raygui.Enable()
 	}
 
+	const labelWidth = 100 * zoomLevel
+	const textSize = 20
+
 	// I love rendering bottom to top!!
 	fieldY := n.UIRect.Y + n.UIRect.Height
 
-	// Group by
+	// Having
 	{
 		fieldY -= UIFieldHeight
+		drawBasicText("Having", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+		havingRect := rl.Rectangle{n.UIRect.X + labelWidth, fieldY, n.UIRect.Width - labelWidth, UIFieldHeight}
+		func() {
+			// Older SQLite only allows HAVING with a GROUP BY.
+			if !d.CanHave() {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			d.Having, _ = d.HavingTextbox.Do(havingRect, d.Having, 100)
+		}()
+	}
+
+	// Group by
+	{
+		fieldY -= UIFieldSpacing + UIFieldHeight
 		if raygui.Button(rl.Rectangle{
 			n.UIRect.X,
 			fieldY,
@@ -151,7 +243,6 @@ func (d *Aggregate) DoUI(n *Node) {
 		}
 
 		fieldY -= UIFieldSpacing + UIFieldHeight
-		const textSize = 20
 		drawBasicText("Group by", n.UIRect.X, fieldY+(UIFieldHeight-textSize), textSize, rl.Black)
 	}
 
@@ -186,6 +277,11 @@ func (d *Aggregate) DoUI(n *Node) {
 					defer raygui.Disable()
 				}
 
+				fieldY -= UIFieldSpacing + UIFieldHeight
+				drawBasicText("where", n.UIRect.X+labelWidth/4, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+				filterRect := rl.Rectangle{n.UIRect.X + labelWidth, fieldY, n.UIRect.Width - labelWidth, UIFieldHeight}
+				agg.Filter, _ = agg.FilterTextbox.Do(filterRect, agg.Filter, 100)
+
 				fieldY -= UIFieldSpacing + UIFieldHeight
 				fieldX := n.UIRect.X
 
@@ -196,9 +292,25 @@ func (d *Aggregate) DoUI(n *Node) {
 				remainingWidth := n.UIRect.X + n.UIRect.Width - fieldX
 				fieldWidth := remainingWidth/2 - UIFieldSpacing/2
 
-				icol := agg.ColDropdown.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight})
-				agg.Col, _ = icol.(string)
-				fieldX += fieldWidth + UIFieldSpacing
+				colWidth := fieldWidth
+				if agg.Type.HasArg() {
+					colWidth -= argWidth + UIFieldSpacing
+				}
+				func() {
+					if !agg.Type.HasCol() {
+						raygui.Disable()
+						defer raygui.Enable()
+					}
+					icol := agg.ColDropdown.Do(rl.Rectangle{fieldX, fieldY, colWidth, UIFieldHeight})
+					agg.Col, _ = icol.(string)
+				}()
+				fieldX += colWidth + UIFieldSpacing
+
+				if agg.Type.HasArg() {
+					argRect := rl.Rectangle{fieldX, fieldY, argWidth, UIFieldHeight}
+					agg.Arg, _ = agg.ArgTextbox.Do(argRect, agg.Arg, 10)
+					fieldX += argWidth + UIFieldSpacing
+				}
 
 				aliasRect := rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight}
 				agg.Alias, _ = agg.AliasTextbox.Do(aliasRect, agg.Alias, 100)
@@ -211,13 +323,19 @@ func (d *Aggregate) Serialize() (res string, active bool) {
 	for _, agg := range d.Aggregates {
 		res += fmt.Sprintf("%v", agg.Type)
 		res += agg.Col
+		res += agg.Arg
 		res += agg.Alias
-		if agg.AliasTextbox.Active {
+		res += agg.Filter
+		if agg.AliasTextbox.Active || agg.ArgTextbox.Active || agg.FilterTextbox.Active {
 			active = true
 		}
 	}
 	for _, gb := range d.GroupBys {
 		res += gb.Col
 	}
+	res += d.Having
+	if d.HavingTextbox.Active {
+		active = true
+	}
 	return
 }
@@ -2,7 +2,11 @@ package app
 
 import (
 	"fmt"
-	"reflect"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -11,10 +15,38 @@ import (
 var ChartColor = rl.NewColor(155, 171, 178, 255)
 
 type Chart struct {
-	ValueCol         string
-	LabelCol         string
-	ValueColDropdown raygui.DropdownEx
-	LabelColDropdown raygui.DropdownEx
+	Type               ChartType
+	ValueCols          []string
+	LabelCol           string // the x values, for scatter charts
+	SeriesCol          string // splits each value column into one series per distinct value
+	Stacked            bool
+	LabelSort          ChartSort // for heatmaps, the columns
+	SeriesSort         ChartSort // for heatmaps, the rows
+	TypeDropdown       raygui.DropdownEx
+	ValueColDropdowns  []*raygui.DropdownEx
+	LabelColDropdown   raygui.DropdownEx
+	SeriesColDropdown  raygui.DropdownEx
+	LabelSortDropdown  raygui.DropdownEx
+	SeriesSortDropdown raygui.DropdownEx
+
+	FillGaps      bool // for dates, adds zeros for the days, weeks, etc. with no rows
+	TimeView      chartTimeView
+	timeViewStart chartTimeView // from when a pan started
+	labelIsDate   bool
+
+	// Labels picked by clicking on bars or slices. The chart's output is
+	// filtered down to the rows with these labels.
+	Selection    []chartSelection
+	SelectionCol string // the label column they were picked from
+	clickStart   rl.Vector2
+	clickPending bool
+
+	ExportPath         string // the extension is swapped for each format
+	ExportResolution   chartResolution
+	ExportStatus       string
+	ExportPathTextbox  raygui.TextBoxEx
+	ResolutionDropdown raygui.DropdownEx
+	pngRequested       bool
 
 	Size      rl.Vector2 // this will be applied to UISize which will determine the node Size. Make sense???
 	StartSize rl.Vector2
@@ -31,80 +63,303 @@ func NewChart() *Node {
 		Color:   ChartColor,
 		Inputs:  make([]*Node, 1),
 		Data: &Chart{
-			Size: rl.Vector2{600, 400},
+			ValueCols:         []string{""},
+			ValueColDropdowns: raygui.MakeDropdownExList(1),
+			ExportPath:        "chart",
+			ExportResolution:  chartResolution{1920, 1080},
+			Size:              rl.Vector2{900, 640},
 		},
 	}
 }
 
+var chartTypeOpts = []raygui.DropdownExOption{
+	{"Bar", BarChart},
+	{"Horizontal bar", HorizontalBarChart},
+	{"Line", LineChart},
+	{"Area", AreaChart},
+	{"Scatter", ScatterChart},
+	{"Pie", PieChart},
+	{"Donut", DonutChart},
+	{"Heatmap", HeatmapChart},
+}
+
+type chartSelection struct {
+	Label string
+	Value interface{} // as it came out of the query, for filtering on
+}
+
+type ChartSort int
+
+const (
+	ChartQueryOrder ChartSort = iota
+	ChartSortByName
+	ChartSortByTotal // biggest first
+)
+
+var chartLabelSortOpts = []raygui.DropdownExOption{
+	{"Labels as is", ChartQueryOrder},
+	{"Labels A-Z", ChartSortByName},
+	{"Labels by total", ChartSortByTotal},
+}
+
+var chartSeriesSortOpts = []raygui.DropdownExOption{
+	{"Series as is", ChartQueryOrder},
+	{"Series A-Z", ChartSortByName},
+	{"Series by total", ChartSortByTotal},
+}
+
 func (c *Chart) Update(n *Node) {
 	if n.Schema == nil {
-		c.QueryResult = doQuery(n.GenerateSql(true))
+		// The chart's own output is filtered by its selection, so it has to
+		// show its input instead.
+		c.QueryResult = &queryResult{}
+		if n.Inputs[0] != nil {
+			c.QueryResult = doQuery(n.Inputs[0].GenerateSql(true))
+		}
 		n.Schema = getSchema(n)
 	}
 
+	if c.SelectionCol != c.LabelCol || !c.Type.CanSelect() {
+		c.Selection = nil
+		c.SelectionCol = c.LabelCol
+	}
+
+	c.TypeDropdown.SetOptions(chartTypeOpts...)
+	c.TypeDropdown.SelectValue(c.Type)
+
 	opts := columnNameDropdownOpts(n.Inputs[0])
-	c.ValueColDropdown.SetOptions(opts...)
+	for _, dropdown := range c.ValueColDropdowns {
+		dropdown.SetOptions(opts...)
+	}
 	c.LabelColDropdown.SetOptions(opts...)
+	c.SeriesColDropdown.SetOptions(append([]raygui.DropdownExOption{{"No split", ""}}, opts...)...)
+	c.SeriesColDropdown.SelectValue(c.SeriesCol)
+	c.LabelSortDropdown.SetOptions(chartLabelSortOpts...)
+	c.LabelSortDropdown.SelectValue(c.LabelSort)
+	c.SeriesSortDropdown.SetOptions(chartSeriesSortOpts...)
+	c.SeriesSortDropdown.SelectValue(c.SeriesSort)
+	c.ResolutionDropdown.SetOptions(chartResolutionOpts...)
+	c.ResolutionDropdown.SelectValue(c.ExportResolution)
+
+	c.labelIsDate = n.Inputs[0] != nil && c.LabelCol != "" && getColumnKinds(n.Inputs[0])[c.LabelCol] == KindDate
+
+	if c.pngRequested {
+		c.pngRequested = false
+		path := chartExportPath(c.ExportPath, ".png")
+		err := exportChartPNG(path, c.ExportResolution, c.Type, c.chartData(), Brightness(n.Color, 0.4))
+		c.setExportStatus(path, err)
+	}
 
 	n.UISize = c.Size
 }
 
+func (c *Chart) setExportStatus(path string, err error) {
+	if err != nil {
+		c.ExportStatus = err.Error()
+	} else {
+		c.ExportStatus = fmt.Sprintf("Exported %s.", path)
+	}
+}
+
 func (c *Chart) DoUI(n *Node) {
+	openDropdown, isOpen := raygui.GetOpenDropdown(c.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	const textSize = 20
+	const statusHeight = UIFieldHeight + UIFieldSpacing
+
+	var exportHeight float32 = 2*UIFieldHeight + UIFieldSpacing
+	if c.ExportStatus != "" {
+		exportHeight += statusHeight
+	}
+
 	{
-		var labelIndex int
-		var valueIndex int
-		for i, col := range c.QueryResult.Columns {
-			if col == c.LabelCol {
-				labelIndex = i
-			}
-			if col == c.ValueCol {
-				valueIndex = i
+		const padding = 20
+		const controlsHeight = 2*UIFieldHeight + UIFieldSpacing
+
+		ink := Brightness(n.Color, 0.4)
+		chartRect := rl.Rectangle{
+			n.UIRect.X,
+			n.UIRect.Y + controlsHeight + padding,
+			n.UIRect.Width,
+			n.UIRect.Height - controlsHeight - exportHeight - 2*padding,
+		}
+		marks := drawChart(rlChartCanvas{}, chartRect, c.Type, c.chartData(), ink)
+
+		mouse := raygui.GetMousePositionWorld()
+		if !isOpen && rl.CheckCollisionPointRec(mouse, chartRect) {
+			if mark, ok := hoveredChartMark(marks, mouse); ok {
+				drawChartTooltip(rlChartCanvas{}, chartRect, mark, mouse, ink)
 			}
 		}
 
-		var series []barChartSeries
+		// buttons along the top right of the chart
+		buttonX := chartRect.X + chartRect.Width
+		chartButton := func(width float32, text string) bool {
+			buttonX -= width
+			clicked := raygui.Button(rl.Rectangle{buttonX, chartRect.Y, width, UIFieldHeight}, text)
+			buttonX -= UIFieldSpacing
+			return clicked
+		}
+		clickedButton := false
+		if c.usesTimeAxis() && c.TimeView.Zoomed() && chartButton(140*zoomLevel, "Reset zoom") {
+			c.TimeView.Start, c.TimeView.End = 0, 0
+			clickedButton = true
+		}
+		if len(c.Selection) > 0 && chartButton(200*zoomLevel, "Clear selection") {
+			c.Selection = nil
+			clickedButton = true
+		}
+
+		if !isOpen && c.usesTimeAxis() {
+			c.doTimeZoom(chartRect)
+		}
+		if !isOpen && !clickedButton && c.Type.CanSelect() {
+			c.doSelection(chartRect, marks)
+		}
+	}
 
-		for _, row := range c.QueryResult.Rows {
-			label := fmt.Sprintf("%v", row[labelIndex])
+	doDropdown := func(d *raygui.DropdownEx, bounds rl.Rectangle) interface{} {
+		if openDropdown == d {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		return d.Do(bounds)
+	}
 
-			var value float64
-			rt := reflect.TypeOf(value)
-			rv := reflect.ValueOf(row[valueIndex])
-			if rv.CanConvert(rt) {
-				value = rv.Convert(rt).Float()
-			}
+	// The rows are drawn bottom to top so that dropdown lists end up on top.
 
-			series = append(series, barChartSeries{
-				Label:  label,
-				Values: []float64{value}, // TODO: moar values!!
-			})
+	// exporting
+	{
+		const resolutionWidth = 180 * zoomLevel
+		buttonsY := n.UIRect.Y + n.UIRect.Height - UIFieldHeight
+		pathY := buttonsY - UIFieldSpacing - UIFieldHeight
+		halfWidth := n.UIRect.Width/2 - UIFieldSpacing/2
+
+		if c.ExportStatus != "" {
+			drawBasicText(c.ExportStatus, n.UIRect.X, pathY-statusHeight+(UIFieldHeight-textSize)/2, textSize, rl.Black)
 		}
 
-		const topPadding = 20
+		if raygui.Button(rl.Rectangle{n.UIRect.X, buttonsY, halfWidth, UIFieldHeight}, "Export PNG") {
+			c.pngRequested = true // done in Update, outside the camera
+		}
+		if raygui.Button(rl.Rectangle{n.UIRect.X + halfWidth + UIFieldSpacing, buttonsY, halfWidth, UIFieldHeight}, "Export SVG") {
+			path := chartExportPath(c.ExportPath, ".svg")
+			c.setExportStatus(path, exportChartSVG(path, c.Type, c.chartData(), Brightness(n.Color, 0.4)))
+		}
 
-		drawBarChart(rl.Rectangle{
+		c.ExportPath, _ = c.ExportPathTextbox.Do(rl.Rectangle{
 			n.UIRect.X,
-			n.UIRect.Y + UIFieldHeight + topPadding,
-			n.UIRect.Width,
-			n.UIRect.Height - UIFieldHeight - topPadding,
-		}, series, n.Color)
+			pathY,
+			n.UIRect.Width - resolutionWidth - UIFieldSpacing,
+			UIFieldHeight,
+		}, c.ExportPath, 200)
+		c.ExportResolution, _ = doDropdown(&c.ResolutionDropdown, rl.Rectangle{
+			n.UIRect.X + n.UIRect.Width - resolutionWidth,
+			pathY,
+			resolutionWidth,
+			UIFieldHeight,
+		}).(chartResolution)
 	}
 
-	valueCol := c.ValueColDropdown.Do(rl.Rectangle{
-		n.UIRect.X,
-		n.UIRect.Y,
-		n.UIRect.Width/2 - UIFieldSpacing/2,
-		UIFieldHeight,
-	})
-	c.ValueCol, _ = valueCol.(string)
+	// value columns and sorting
+	{
+		const buttonsWidth = 2 * (UIFieldHeight + UIFieldSpacing)
+		const sortWidth = 170 * zoomLevel
+		rowY := n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+		valuesRight := n.UIRect.X + n.UIRect.Width - 2*(sortWidth+UIFieldSpacing)
+		dropdownWidth := (valuesRight-n.UIRect.X-buttonsWidth)/float32(len(c.ValueColDropdowns)) - UIFieldSpacing
+
+		c.SeriesSort, _ = doDropdown(&c.SeriesSortDropdown, rl.Rectangle{
+			n.UIRect.X + n.UIRect.Width - sortWidth,
+			rowY,
+			sortWidth,
+			UIFieldHeight,
+		}).(ChartSort)
+		c.LabelSort, _ = doDropdown(&c.LabelSortDropdown, rl.Rectangle{
+			valuesRight + UIFieldSpacing,
+			rowY,
+			sortWidth,
+			UIFieldHeight,
+		}).(ChartSort)
+
+		if raygui.Button(rl.Rectangle{
+			valuesRight - buttonsWidth + UIFieldSpacing,
+			rowY,
+			UIFieldHeight,
+			UIFieldHeight,
+		}, "+") {
+			c.ValueCols = append(c.ValueCols, "")
+			c.ValueColDropdowns = append(c.ValueColDropdowns, raygui.MakeDropdownExList(1)...)
+		}
+		if raygui.Button(rl.Rectangle{
+			valuesRight - UIFieldHeight,
+			rowY,
+			UIFieldHeight,
+			UIFieldHeight,
+		}, "-") {
+			if len(c.ValueCols) > 1 {
+				c.ValueCols = c.ValueCols[:len(c.ValueCols)-1]
+				c.ValueColDropdowns = c.ValueColDropdowns[:len(c.ValueColDropdowns)-1]
+			}
+		}
 
-	labelCol := c.LabelColDropdown.Do(rl.Rectangle{
-		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
-		n.UIRect.Y,
-		n.UIRect.Width/2 - UIFieldSpacing/2,
-		UIFieldHeight,
-	})
-	c.LabelCol, _ = labelCol.(string)
+		for i, dropdown := range c.ValueColDropdowns {
+			c.ValueCols[i], _ = doDropdown(dropdown, rl.Rectangle{
+				n.UIRect.X + float32(i)*(dropdownWidth+UIFieldSpacing),
+				rowY,
+				dropdownWidth,
+				UIFieldHeight,
+			}).(string)
+		}
+	}
+
+	// type, label, split, stacking, and gap filling
+	{
+		const stackedWidth = 140 * zoomLevel
+		const fillGapsWidth = 140 * zoomLevel
+		dropdownWidth := (n.UIRect.Width-stackedWidth-fillGapsWidth-UIFieldSpacing)/3 - UIFieldSpacing
+		dropdownRect := func(i int) rl.Rectangle {
+			return rl.Rectangle{
+				n.UIRect.X + float32(i)*(dropdownWidth+UIFieldSpacing),
+				n.UIRect.Y,
+				dropdownWidth,
+				UIFieldHeight,
+			}
+		}
+
+		func() {
+			if !c.Type.CanStack() {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			c.Stacked = raygui.Toggle(rl.Rectangle{
+				n.UIRect.X + n.UIRect.Width - fillGapsWidth - UIFieldSpacing - stackedWidth,
+				n.UIRect.Y,
+				stackedWidth,
+				UIFieldHeight,
+			}, "Stacked", c.Stacked)
+		}()
+		func() {
+			if !c.usesTimeAxis() {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			c.FillGaps = raygui.Toggle(rl.Rectangle{
+				n.UIRect.X + n.UIRect.Width - fillGapsWidth,
+				n.UIRect.Y,
+				fillGapsWidth,
+				UIFieldHeight,
+			}, "Fill gaps", c.FillGaps)
+		}()
+
+		c.SeriesCol, _ = doDropdown(&c.SeriesColDropdown, dropdownRect(2)).(string)
+		c.LabelCol, _ = doDropdown(&c.LabelColDropdown, dropdownRect(1)).(string)
+		c.Type, _ = doDropdown(&c.TypeDropdown, dropdownRect(0)).(ChartType)
+	}
 
 	// dragging
 	{
@@ -137,79 +392,396 @@ func (c *Chart) DoUI(n *Node) {
 	}
 }
 
+// Whether the labels are dates, and so get placed by time.
+func (c *Chart) usesTimeAxis() bool {
+	return c.labelIsDate && c.Type.CanPlotTime()
+}
+
+// Zooms the time axis with the mouse wheel and pans it by dragging, like the
+// canvas itself.
+func (c *Chart) doTimeZoom(chartRect rl.Rectangle) {
+	if rl.CheckCollisionPointRec(raygui.GetMousePositionWorld(), chartRect) {
+		didCaptureScrollThisFrame = true
+		if wheel := float64(rl.GetMouseWheelMove()); wheel != 0 {
+			c.TimeView.ZoomAt(raygui.GetMousePositionWorld().X, math.Pow(0.8, wheel))
+		}
+	}
+
+	panDragKey := fmt.Sprintf("pan: %p", c)
+	if tryStartDrag(panDragKey, chartRect, rl.Vector2{}) {
+		c.timeViewStart = c.TimeView
+	}
+	if panningThis, _, canceled := dragState(panDragKey); panningThis {
+		if canceled {
+			c.TimeView.Start, c.TimeView.End = c.timeViewStart.Start, c.timeViewStart.End
+		} else {
+			c.TimeView.PanFrom(c.timeViewStart, dragOffset().X)
+		}
+	}
+
+}
+
+// Clicking a bar or slice selects its label, and shift-clicking adds it to
+// (or takes it out of) the selection. Clicking anything else in the chart
+// clears it. Drags, like panning, don't count.
+func (c *Chart) doSelection(chartRect rl.Rectangle, marks []chartMark) {
+	mouse := raygui.GetMousePositionWorld()
+	if rl.IsMouseButtonPressed(rl.MouseLeftButton) {
+		c.clickStart = mouse
+		c.clickPending = rl.CheckCollisionPointRec(mouse, chartRect)
+	}
+	if !rl.IsMouseButtonReleased(rl.MouseLeftButton) || !c.clickPending {
+		return
+	}
+	c.clickPending = false
+	if rl.Vector2Length(rl.Vector2Subtract(mouse, c.clickStart)) >= 3 {
+		return
+	}
+
+	shift := rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+	mark, ok := hoveredChartMark(marks, mouse)
+	var value interface{}
+	if ok {
+		if value, ok = c.labelValue(mark.Label); !ok {
+			return // a gap filled in with zero, which no rows would match
+		}
+	}
+	switch {
+	case !ok:
+		if !shift {
+			c.Selection = nil
+		}
+	case shift:
+		for i, sel := range c.Selection {
+			if sel.Label == mark.Label {
+				c.Selection = append(c.Selection[:i:i], c.Selection[i+1:]...)
+				return
+			}
+		}
+		c.Selection = append(c.Selection, chartSelection{mark.Label, value})
+	case len(c.Selection) == 1 && c.Selection[0].Label == mark.Label:
+		c.Selection = nil
+	default:
+		c.Selection = []chartSelection{{mark.Label, value}}
+	}
+}
+
+// Finds the value in the query result that a label came from. Labels made up
+// to fill gaps in dates don't have one.
+func (c *Chart) labelValue(label string) (interface{}, bool) {
+	labelIndex := -1
+	for i, col := range c.QueryResult.Columns {
+		if col == c.LabelCol {
+			labelIndex = i
+		}
+	}
+	if labelIndex >= 0 {
+		for _, row := range c.QueryResult.Rows {
+			if chartLabel(row[labelIndex]) == label {
+				return row[labelIndex], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// SelectionCondition Gets the condition that keeps only the rows with a
+// selected label, or "" when nothing is selected.
+func (c *Chart) SelectionCondition() string {
+	var literals []string
+	hasNull := false
+	for _, sel := range c.Selection {
+		if sel.Value == nil {
+			hasNull = true
+		} else {
+			literals = append(literals, sqlValueLiteral(sel.Value))
+		}
+	}
+
+	var conditions []string
+	switch len(literals) {
+	case 0:
+	case 1:
+		conditions = append(conditions, fmt.Sprintf("%s = %s", c.SelectionCol, literals[0]))
+	default:
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", c.SelectionCol, strings.Join(literals, ", ")))
+	}
+	if hasNull {
+		conditions = append(conditions, fmt.Sprintf("%s IS NULL", c.SelectionCol))
+	}
+
+	if len(conditions) > 1 {
+		return "(" + strings.Join(conditions, " OR ") + ")"
+	}
+	return strings.Join(conditions, "")
+}
+
+// Serialize Only the selection affects the chart's output.
 func (c *Chart) Serialize() (string, bool) {
-	return "", false
+	return c.SelectionCondition(), false
 }
 
 func (c *Chart) Dropdowns() []*raygui.DropdownEx {
 	var res []*raygui.DropdownEx
-	res = append(res, &c.ValueColDropdown)
+	res = append(res, &c.TypeDropdown)
 	res = append(res, &c.LabelColDropdown)
+	res = append(res, &c.SeriesColDropdown)
+	res = append(res, &c.LabelSortDropdown)
+	res = append(res, &c.SeriesSortDropdown)
+	res = append(res, c.ValueColDropdowns...)
+	res = append(res, &c.ResolutionDropdown)
 	return res
 }
 
-type barChartSeries struct {
-	Label  string
-	Values []float64
-}
+// Pulls the chosen columns out of the query result, one series per value
+// column. With a split column, each value column is further split into one
+// series per distinct value, and rows with the same label are added up.
+// Values that aren't numbers are left as gaps. Heatmaps use the series as
+// their rows.
+func (c *Chart) chartData() *chartData {
+	data := &chartData{
+		Stacked: c.Stacked,
+		XTitle:  c.LabelCol,
+		YTitle:  strings.Join(c.ValueCols, ", "),
+	}
+	if len(c.Selection) > 0 {
+		data.Selected = make(map[string]bool)
+		for _, sel := range c.Selection {
+			data.Selected[sel.Label] = true
+		}
+	}
+	if c.Type == HeatmapChart {
+		data.YTitle = c.SeriesCol
+		data.ValueTitle = strings.Join(c.ValueCols, ", ")
+	}
+	if c.QueryResult == nil {
+		return data
+	}
+
+	labelIndex, seriesIndex := -1, -1
+	valueIndexes := make([]int, len(c.ValueCols))
+	for i := range valueIndexes {
+		valueIndexes[i] = -1
+	}
+	for i, col := range c.QueryResult.Columns {
+		if col == c.LabelCol {
+			labelIndex = i
+		}
+		if col == c.SeriesCol {
+			seriesIndex = i
+		}
+		for vi, valueCol := range c.ValueCols {
+			if col == valueCol {
+				valueIndexes[vi] = i
+			}
+		}
+	}
+	if labelIndex < 0 {
+		return data
+	}
+
+	var series []*chartSeries
+	seriesByName := make(map[string]*chartSeries)
+	pointsByLabel := make(map[string]int)
+	numPoints := 0
+
+	for _, row := range c.QueryResult.Rows {
+		var point int
+		if c.Type == ScatterChart {
+			x, ok := sqlNumber(row[labelIndex])
+			if !ok {
+				continue
+			}
+			point = len(data.XValues)
+			data.XValues = append(data.XValues, x)
+		} else {
+			label := chartLabel(row[labelIndex])
+			var t time.Time
+			if c.usesTimeAxis() {
+				var ok bool
+				if t, ok = parseChartTime(row[labelIndex]); !ok {
+					continue
+				}
+			}
+			existing, seen := pointsByLabel[label]
+			if seriesIndex >= 0 && seen {
+				point = existing
+			} else {
+				point = len(data.Labels)
+				data.Labels = append(data.Labels, label)
+				pointsByLabel[label] = point
+				if c.usesTimeAxis() {
+					data.Times = append(data.Times, float64(t.Unix()))
+				}
+			}
+		}
+		numPoints = point + 1
+
+		for vi, valueIndex := range valueIndexes {
+			if valueIndex < 0 {
+				continue
+			}
+
+			name := c.ValueCols[vi]
+			if seriesIndex >= 0 {
+				split := chartLabel(row[seriesIndex])
+				if len(valueIndexes) > 1 {
+					name = split + " " + name
+				} else {
+					name = split
+				}
+			}
 
-func drawBarChart(bounds rl.Rectangle, series []barChartSeries, nodeColor rl.Color) {
-	const spacingBetweenSeries = 0.5 // times width of series
+			s, ok := seriesByName[name]
+			if !ok {
+				s = &chartSeries{Name: name}
+				seriesByName[name] = s
+				series = append(series, s)
+			}
+			for len(s.Values) <= point {
+				s.Values = append(s.Values, math.NaN())
+			}
 
-	color := Brightness(nodeColor, 0.4)
+			if value, ok := sqlNumber(row[valueIndex]); ok {
+				if math.IsNaN(s.Values[point]) {
+					s.Values[point] = value
+				} else {
+					s.Values[point] += value
+				}
+			}
+		}
+	}
 
-	var maxVal float64
 	for _, s := range series {
-		for _, v := range s.Values {
-			if v > maxVal {
-				maxVal = v
+		for len(s.Values) < numPoints {
+			s.Values = append(s.Values, math.NaN())
+		}
+		data.Series = append(data.Series, *s)
+	}
+
+	if c.usesTimeAxis() {
+		sortChartTimes(data)
+		if c.FillGaps {
+			fillTimeGaps(data)
+		}
+		data.TimeView = &c.TimeView
+	} else if c.Type != ScatterChart {
+		sortChartLabels(data, c.LabelSort)
+	}
+	sortChartSeries(data, c.SeriesSort)
+
+	return data
+}
+
+// Formats a value of the label or series column. NULL is written out like in
+// the results grid, and times the way SQLite writes them, leaving off
+// midnight.
+func chartLabel(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	if t, ok := v.(time.Time); ok {
+		return strings.TrimSuffix(t.Format("2006-01-02 15:04:05"), " 00:00:00")
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Compares labels as numbers when they both are, so that 2 comes before 10.
+func chartLabelLess(a, b string) bool {
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		return af < bf
+	}
+	return a < b
+}
+
+// Adds up values, skipping gaps.
+func chartTotal(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			total += v
+		}
+	}
+	return total
+}
+
+// Reorders the labels, along with every series' values.
+func sortChartLabels(data *chartData, order ChartSort) {
+	if order == ChartQueryOrder {
+		return
+	}
+
+	totals := make([]float64, len(data.Labels))
+	for i := range data.Labels {
+		for _, s := range data.Series {
+			if v := s.Values[i]; !math.IsNaN(v) {
+				totals[i] += v
 			}
 		}
 	}
 
-	totalAbstractWidth := float32(len(series)) + spacingBetweenSeries*float32(len(series)-1)
-	seriesWidth := bounds.Width / totalAbstractWidth
-	spacingWidth := seriesWidth * spacingBetweenSeries
+	perm := make([]int, len(data.Labels))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(i, j int) bool {
+		a, b := perm[i], perm[j]
+		if order == ChartSortByTotal {
+			return totals[a] > totals[b]
+		}
+		return chartLabelLess(data.Labels[a], data.Labels[b])
+	})
 
-	x := bounds.X
-	for _, s := range series {
-		barWidth := seriesWidth / float32(len(s.Values))
-
-		var textHeight float32
-		textY := bounds.Y + bounds.Height
-		if seriesWidth > 30 {
-			textHeight = UIFieldHeight
-			textY -= textHeight
-
-			const textSize = 20
-			textMeasured := measureBasicText(s.Label, textSize)
-
-			var size float32 = textSize
-			if textMeasured.X > seriesWidth {
-				resizeRatio := (seriesWidth / textMeasured.X)
-				size = size * resizeRatio
-				textMeasured.X = seriesWidth
-				textMeasured.Y = textMeasured.Y * resizeRatio
-			}
-
-			drawBasicText(
-				s.Label,
-				x+seriesWidth/2-textMeasured.X/2,
-				textY+textHeight/2-textMeasured.Y/2,
-				size, color,
-			)
-		}
-
-		for _, v := range s.Values {
-			barHeight := float32(v/maxVal) * (bounds.Height - textHeight)
-			rl.DrawRectangleRec(rl.Rectangle{
-				x,
-				textY - barHeight,
-				barWidth,
-				barHeight,
-			}, color)
-			x += barWidth
-		}
-		x += spacingWidth
+	permuteChartLabels(data, perm)
+}
+
+// Puts dates in order, since lines and areas connect points in order.
+func sortChartTimes(data *chartData) {
+	perm := make([]int, len(data.Labels))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(i, j int) bool {
+		return data.Times[perm[i]] < data.Times[perm[j]]
+	})
+	permuteChartLabels(data, perm)
+}
+
+// Rearranges the labels so that the ith one is the one that was at perm[i],
+// moving their times and every series' values along with them.
+func permuteChartLabels(data *chartData, perm []int) {
+	labels := make([]string, len(perm))
+	for i, from := range perm {
+		labels[i] = data.Labels[from]
+	}
+	data.Labels = labels
+	if data.Times != nil {
+		times := make([]float64, len(perm))
+		for i, from := range perm {
+			times[i] = data.Times[from]
+		}
+		data.Times = times
+	}
+	for si := range data.Series {
+		values := make([]float64, len(perm))
+		for i, from := range perm {
+			values[i] = data.Series[si].Values[from]
+		}
+		data.Series[si].Values = values
+	}
+}
+
+func sortChartSeries(data *chartData, order ChartSort) {
+	switch order {
+	case ChartSortByName:
+		sort.SliceStable(data.Series, func(i, j int) bool {
+			return chartLabelLess(data.Series[i].Name, data.Series[j].Name)
+		})
+	case ChartSortByTotal:
+		sort.SliceStable(data.Series, func(i, j int) bool {
+			return chartTotal(data.Series[i].Values) > chartTotal(data.Series[j].Values)
+		})
 	}
 }
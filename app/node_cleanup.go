@@ -0,0 +1,212 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var CleanupColor = rl.NewColor(190, 160, 230, 255)
+
+type Cleanup struct {
+	Rules []*CleanupRule
+}
+
+type CleanupRule struct {
+	Col    string
+	Action CleanupAction
+	Arg    string // a constant, or a column name for FillNullFromCol
+
+	ColDropdown    raygui.DropdownEx
+	ActionDropdown raygui.DropdownEx
+	ArgColDropdown raygui.DropdownEx
+	ArgTextbox     raygui.TextBoxEx
+}
+
+type CleanupAction int
+
+const (
+	FillNull CleanupAction = iota + 1
+	FillNullFromCol
+	NullIf
+	CastInteger
+	CastReal
+	CastText
+	Trim
+	Lowercase
+)
+
+func NewCleanup() *Node {
+	return &Node{
+		Title:   "Clean Up",
+		CanSnap: true,
+		Color:   CleanupColor,
+		Inputs:  make([]*Node, 1),
+		Data: &Cleanup{
+			Rules: []*CleanupRule{{}},
+		},
+	}
+}
+
+var cleanupActionOpts = []raygui.DropdownExOption{
+	{"Fill NULL with", FillNull},
+	{"Fill NULL from", FillNullFromCol},
+	{"NULL if equal", NullIf},
+	{"As INTEGER", CastInteger},
+	{"As REAL", CastReal},
+	{"As TEXT", CastText},
+	{"Trim", Trim},
+	{"Lowercase", Lowercase},
+}
+
+func (a CleanupAction) HasConstant() bool {
+	return a == FillNull || a == NullIf
+}
+
+func (a CleanupAction) HasColumn() bool {
+	return a == FillNullFromCol
+}
+
+// Wraps the given SQL expression in whatever this rule does to it.
+func (r *CleanupRule) Apply(expr string) string {
+	switch r.Action {
+	case FillNull:
+		return fmt.Sprintf("COALESCE(%s, %s)", expr, sqlLiteral(r.Arg))
+	case FillNullFromCol:
+		if r.Arg == "" {
+			return expr
+		}
+		return fmt.Sprintf("COALESCE(%s, %s)", expr, r.Arg)
+	case NullIf:
+		return fmt.Sprintf("NULLIF(%s, %s)", expr, sqlLiteral(r.Arg))
+	case CastInteger:
+		return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+	case CastReal:
+		return fmt.Sprintf("CAST(%s AS REAL)", expr)
+	case CastText:
+		return fmt.Sprintf("CAST(%s AS TEXT)", expr)
+	case Trim:
+		return fmt.Sprintf("TRIM(%s)", expr)
+	case Lowercase:
+		return fmt.Sprintf("LOWER(%s)", expr)
+	default:
+		return expr
+	}
+}
+
+// Gets the cleaned-up expression for a column. Rules are applied in order, so
+// a column can be trimmed, then lowercased, then have its NULLs filled.
+func (d *Cleanup) ColumnExpression(col string) string {
+	expr := col
+	for _, rule := range d.Rules {
+		if rule.Col == col {
+			expr = rule.Apply(expr)
+		}
+	}
+	return expr
+}
+
+func (d *Cleanup) AllDropdowns() []*raygui.DropdownEx {
+	res := make([]*raygui.DropdownEx, 0, 3*len(d.Rules))
+	for _, rule := range d.Rules {
+		res = append(res, &rule.ColDropdown)
+		res = append(res, &rule.ActionDropdown)
+		res = append(res, &rule.ArgColDropdown)
+	}
+	return res
+}
+
+func (d *Cleanup) Update(n *Node) {
+	uiHeight := 0
+	for range d.Rules {
+		uiHeight += UIFieldHeight
+		uiHeight += UIFieldSpacing
+	}
+	uiHeight += UIFieldHeight // for buttons
+
+	n.UISize = rl.Vector2{600, float32(uiHeight)}
+
+	colOpts := columnNameDropdownOpts(n.Inputs[0])
+	for _, rule := range d.Rules {
+		rule.ColDropdown.SetOptions(colOpts...)
+		rule.ActionDropdown.SetOptions(cleanupActionOpts...)
+		rule.ArgColDropdown.SetOptions(colOpts...)
+	}
+}
+
+func (d *Cleanup) DoUI(n *Node) {
+	const actionWidth = 170 * zoomLevel
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.AllDropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	fieldY := n.UIRect.Y + n.UIRect.Height - UIFieldHeight
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "+") {
+		d.Rules = append(d.Rules, &CleanupRule{})
+	}
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "-") {
+		if len(d.Rules) > 1 {
+			d.Rules = d.Rules[:len(d.Rules)-1]
+		}
+	}
+
+	for i := len(d.Rules) - 1; i >= 0; i-- {
+		func() {
+			fieldY -= UIFieldSpacing + UIFieldHeight
+
+			rule := d.Rules[i]
+			if openDropdown == &rule.ColDropdown || openDropdown == &rule.ActionDropdown || openDropdown == &rule.ArgColDropdown {
+				raygui.Enable()
+				defer raygui.Disable()
+			}
+
+			fieldX := n.UIRect.X
+			remainingWidth := n.UIRect.Width - actionWidth - 2*UIFieldSpacing
+			colWidth := remainingWidth / 2
+
+			// The argument goes on the right, but it has to be drawn before
+			// the action dropdown so the dropdown's list ends up on top.
+			argRect := rl.Rectangle{fieldX + colWidth + UIFieldSpacing + actionWidth + UIFieldSpacing, fieldY, colWidth, UIFieldHeight}
+			if rule.Action.HasColumn() {
+				argCol := rule.ArgColDropdown.Do(argRect)
+				rule.Arg, _ = argCol.(string)
+			} else if rule.Action.HasConstant() {
+				rule.Arg, _ = rule.ArgTextbox.Do(argRect, rule.Arg, 100)
+			}
+
+			action := rule.ActionDropdown.Do(rl.Rectangle{fieldX + colWidth + UIFieldSpacing, fieldY, actionWidth, UIFieldHeight})
+			rule.Action, _ = action.(CleanupAction)
+
+			col := rule.ColDropdown.Do(rl.Rectangle{fieldX, fieldY, colWidth, UIFieldHeight})
+			rule.Col, _ = col.(string)
+		}()
+	}
+}
+
+func (d *Cleanup) Serialize() (res string, active bool) {
+	for _, rule := range d.Rules {
+		res += rule.Col
+		res += fmt.Sprintf("%v", rule.Action)
+		res += rule.Arg
+		if rule.ArgTextbox.Active {
+			active = true
+		}
+	}
+	return
+}
@@ -11,7 +11,10 @@ var CombineRowsColor = rl.NewColor(30, 188, 115, 255)
 
 type CombineRows struct {
 	CombinationType CombineType
+	MatchByName     bool // line columns up by name instead of position
 	Dropdown        raygui.DropdownEx
+
+	Status string // set during Update if the inputs don't line up
 }
 
 type CombineType int
@@ -43,15 +46,104 @@ var combineRowsOpts = []raygui.DropdownExOption{
 }
 
 func (d *CombineRows) Update(n *Node) {
-	n.UISize = rl.Vector2{X: 240, Y: 54}
+	if n.Schema == nil {
+		d.checkSchemas(n)
+		n.Schema = getSchema(n)
+	}
+
+	rows := 3 // type, match by name, +/- buttons
+	if d.Status != "" {
+		rows++
+	}
+	uiHeight := float32(rows)*UIFieldHeight + float32(rows-1)*UIFieldSpacing
+
+	n.InputPinHeights = make([]int, len(n.Inputs))
+	for i := range n.Inputs {
+		n.InputPinHeights[i] = int(float32(i) * UIFieldHeight)
+	}
+	if pinsHeight := float32(len(n.Inputs)) * UIFieldHeight; uiHeight < pinsHeight {
+		uiHeight = pinsHeight
+	}
+
+	n.UISize = rl.Vector2{X: 560, Y: uiHeight}
 	d.Dropdown.SetOptions(combineRowsOpts...)
+	d.Dropdown.SelectValue(d.CombinationType)
+}
+
+// Checks that the inputs line up by position, unless they're being matched
+// by name.
+func (d *CombineRows) checkSchemas(n *Node) {
+	d.Status = ""
+	if d.MatchByName {
+		return
+	}
+
+	var schemas [][]string
+	var inputNums []int // for error messages
+	for i, input := range n.Inputs {
+		if input != nil {
+			schemas = append(schemas, getSchema(input))
+			inputNums = append(inputNums, i+1)
+		}
+	}
+	if len(schemas) > 0 {
+		d.Status = checkCombinedSchemas(schemas, inputNums)
+	}
 }
 
 func (d *CombineRows) DoUI(n *Node) {
-	chosen := d.Dropdown.Do(n.UIRect)
-	d.CombinationType = chosen.(CombineType)
+	const textSize = 20
+
+	dropdownOpen := d.Dropdown.Open
+	if dropdownOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	// The dropdown is drawn last so its list ends up on top.
+	fieldY := n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+	d.MatchByName = raygui.Toggle(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width,
+		UIFieldHeight,
+	}, "Match by name", d.MatchByName)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	if d.Status != "" {
+		drawBasicText(d.Status, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+		fieldY += UIFieldHeight + UIFieldSpacing
+	}
+
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "+") {
+		n.Inputs = append(n.Inputs, nil)
+	}
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "-") {
+		if len(n.Inputs) > 2 {
+			n.Inputs = n.Inputs[:len(n.Inputs)-1]
+		}
+	}
+
+	func() {
+		if dropdownOpen {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		chosen := d.Dropdown.Do(rl.Rectangle{n.UIRect.X, n.UIRect.Y, n.UIRect.Width, UIFieldHeight})
+		d.CombinationType = chosen.(CombineType)
+	}()
 }
 
 func (d *CombineRows) Serialize() (res string, active bool) {
-	return fmt.Sprintf("%v", d.CombinationType), false
+	return fmt.Sprintf("%v%v", d.CombinationType, d.MatchByName), false
 }
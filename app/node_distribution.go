@@ -0,0 +1,341 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var DistributionColor = rl.NewColor(178, 160, 196, 255)
+
+type Distribution struct {
+	Kind     DistributionKind
+	Col      string
+	SplitCol string // draws one histogram layer or box per distinct value
+	AutoBins bool
+	BinCount string
+
+	KindDropdown     raygui.DropdownEx
+	ColDropdown      raygui.DropdownEx
+	SplitColDropdown raygui.DropdownEx
+	BinCountTextbox  raygui.TextBoxEx
+
+	Status string
+
+	Size      rl.Vector2
+	StartSize rl.Vector2
+
+	Data *distributionData
+}
+
+var _ NodeData = &Distribution{}
+
+func NewDistribution() *Node {
+	return &Node{
+		Title:   "Distribution",
+		CanSnap: true,
+		Color:   DistributionColor,
+		Inputs:  make([]*Node, 1),
+		Data: &Distribution{
+			AutoBins: true,
+			BinCount: "20",
+			Size:     rl.Vector2{800, 560},
+		},
+	}
+}
+
+var distributionKindOpts = []raygui.DropdownExOption{
+	{"Histogram", Histogram},
+	{"Box plot", BoxPlot},
+}
+
+// FixedBins Gets the number of bins to use, or 0 to pick automatically.
+// Anything that isn't a positive number is treated as 1.
+func (d *Distribution) FixedBins() int {
+	if d.AutoBins {
+		return 0
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(d.BinCount))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+func (d *Distribution) Update(n *Node) {
+	if n.Schema == nil {
+		d.Data = d.query(n)
+		n.Schema = getSchema(n)
+	}
+
+	d.KindDropdown.SetOptions(distributionKindOpts...)
+	d.KindDropdown.SelectValue(d.Kind)
+
+	opts := columnNameDropdownOpts(n.Inputs[0])
+	d.ColDropdown.SetOptions(opts...)
+	d.ColDropdown.SelectValue(d.Col)
+	d.SplitColDropdown.SetOptions(append([]raygui.DropdownExOption{{"No split", ""}}, opts...)...)
+	d.SplitColDropdown.SelectValue(d.SplitCol)
+
+	n.UISize = d.Size
+}
+
+// The start of every query the node runs: the numbers in the column, each
+// with the value of the split column, or NULL when there isn't one. Anything
+// that isn't a number is left out.
+func (d *Distribution) valuesSql(input *Node) string {
+	group := "NULL"
+	if d.SplitCol != "" {
+		group = d.SplitCol
+	}
+	return fmt.Sprintf(
+		"WITH vals AS (\nSELECT %s AS grp, %s AS x FROM (\n%s\n)\nWHERE typeof(%s) IN ('integer', 'real')\n)",
+		group, d.Col, input.GenerateSql(false), d.Col,
+	)
+}
+
+// query Summarizes the column with generated SQL. Unlike a preview, this
+// covers every row of the input, not just the first thousand.
+func (d *Distribution) query(n *Node) *distributionData {
+	data := &distributionData{
+		Title:      d.Col,
+		SplitTitle: d.SplitCol,
+	}
+	d.Status = ""
+	if n.Inputs[0] == nil || d.Col == "" {
+		return data
+	}
+
+	vals := d.valuesSql(n.Inputs[0])
+	groupName := func(v interface{}) string {
+		if v == nil {
+			if d.SplitCol == "" {
+				return ""
+			}
+			return "NULL"
+		}
+		return fmt.Sprintf("%v", v)
+	}
+	number := func(v interface{}) float64 {
+		f, _ := sqlNumber(v)
+		return f
+	}
+
+	stats := doQuery(vals + `, stats AS (
+SELECT grp, COUNT(*) AS n, MIN(x) AS lo, percentile(x, 25) AS q1, percentile(x, 50) AS median, percentile(x, 75) AS q3, MAX(x) AS hi
+FROM vals
+GROUP BY grp
+)
+SELECT s.grp, s.n, s.lo, s.q1, s.median, s.q3, s.hi,
+	MIN(CASE WHEN v.x >= s.q1 - 1.5 * (s.q3 - s.q1) THEN v.x END),
+	MAX(CASE WHEN v.x <= s.q3 + 1.5 * (s.q3 - s.q1) THEN v.x END)
+FROM stats s JOIN vals v ON v.grp IS s.grp
+GROUP BY s.grp
+ORDER BY s.grp`)
+
+	groupIndexes := make(map[string]int)
+	total := 0
+	for _, row := range stats.Rows {
+		g := distributionGroup{
+			Name:        groupName(row[0]),
+			Count:       int(number(row[1])),
+			Min:         number(row[2]),
+			Q1:          number(row[3]),
+			Median:      number(row[4]),
+			Q3:          number(row[5]),
+			Max:         number(row[6]),
+			WhiskerLow:  number(row[7]),
+			WhiskerHigh: number(row[8]),
+		}
+		groupIndexes[g.Name] = len(data.Groups)
+		data.Groups = append(data.Groups, g)
+		total += g.Count
+	}
+	if len(data.Groups) == 0 {
+		return data
+	}
+	d.Status = fmt.Sprintf("%d values", total)
+
+	switch d.Kind {
+	case Histogram:
+		// The bins are shared by all the groups, so they're picked from
+		// all the values together.
+		overall := doQuery(vals + "\nSELECT COUNT(*), MIN(x), MAX(x), percentile(x, 25), percentile(x, 75) FROM vals")
+		if len(overall.Rows) == 0 {
+			return data
+		}
+		row := overall.Rows[0]
+		data.BinStart, data.BinWidth, data.NumBins = histogramBins(
+			int(number(row[0])), number(row[1]), number(row[2]), number(row[3]), number(row[4]),
+			d.FixedBins(),
+		)
+		d.Status += fmt.Sprintf(", %d bins of %s", data.NumBins, binEdgeLabel(data.BinWidth))
+
+		for i := range data.Groups {
+			data.Groups[i].Bins = make([]int, data.NumBins)
+		}
+		bins := doQuery(fmt.Sprintf(
+			"%s\nSELECT grp, MAX(0, MIN(CAST((x - %s) / %s AS INTEGER), %d)) AS bin, COUNT(*)\nFROM vals\nGROUP BY grp, bin",
+			vals,
+			strconv.FormatFloat(data.BinStart, 'g', -1, 64),
+			strconv.FormatFloat(data.BinWidth, 'g', -1, 64),
+			data.NumBins-1,
+		))
+		for _, row := range bins.Rows {
+			gi, ok := groupIndexes[groupName(row[0])]
+			bin := int(number(row[1]))
+			if ok && 0 <= bin && bin < data.NumBins {
+				data.Groups[gi].Bins[bin] += int(number(row[2]))
+			}
+		}
+	case BoxPlot:
+		outliers := doQuery(vals + `, stats AS (
+SELECT grp, percentile(x, 25) AS q1, percentile(x, 75) AS q3
+FROM vals
+GROUP BY grp
+)
+SELECT v.grp, v.x
+FROM vals v JOIN stats s ON v.grp IS s.grp
+WHERE v.x < s.q1 - 1.5 * (s.q3 - s.q1) OR v.x > s.q3 + 1.5 * (s.q3 - s.q1)
+LIMIT 1000`)
+		for _, row := range outliers.Rows {
+			if gi, ok := groupIndexes[groupName(row[0])]; ok {
+				data.Groups[gi].Outliers = append(data.Groups[gi].Outliers, number(row[1]))
+			}
+		}
+	}
+
+	return data
+}
+
+func (d *Distribution) DoUI(n *Node) {
+	const autoBinsWidth = 160 * zoomLevel
+	const binCountWidth = 100 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	binsY := n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+
+	{
+		const padding = 20
+		const controlsHeight = 2*UIFieldHeight + UIFieldSpacing
+
+		ink := Brightness(n.Color, 0.4)
+		chartRect := rl.Rectangle{
+			n.UIRect.X,
+			n.UIRect.Y + controlsHeight + padding,
+			n.UIRect.Width,
+			n.UIRect.Height - controlsHeight - padding,
+		}
+		data := d.Data
+		if data == nil {
+			data = &distributionData{}
+		}
+		marks := drawDistribution(rlChartCanvas{}, chartRect, d.Kind, data, ink)
+
+		mouse := raygui.GetMousePositionWorld()
+		if !isOpen && rl.CheckCollisionPointRec(mouse, chartRect) {
+			if mark, ok := hoveredChartMark(marks, mouse); ok {
+				drawChartTooltip(rlChartCanvas{}, chartRect, mark, mouse, ink)
+			}
+		}
+	}
+
+	// binning, which only applies to histograms
+	func() {
+		if d.Kind != Histogram {
+			raygui.Disable()
+			defer raygui.Enable()
+		}
+		d.AutoBins = raygui.Toggle(rl.Rectangle{n.UIRect.X, binsY, autoBinsWidth, UIFieldHeight}, "Auto bins", d.AutoBins)
+		func() {
+			if d.AutoBins {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			d.BinCount, _ = d.BinCountTextbox.Do(rl.Rectangle{
+				n.UIRect.X + autoBinsWidth + UIFieldSpacing,
+				binsY,
+				binCountWidth,
+				UIFieldHeight,
+			}, d.BinCount, 4)
+		}()
+	}()
+	drawBasicText(d.Status, n.UIRect.X+autoBinsWidth+binCountWidth+2*UIFieldSpacing, binsY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+
+	// kind, column, and split, last so the dropdowns draw on top
+	{
+		dropdownWidth := n.UIRect.Width/3 - UIFieldSpacing*2/3
+		dropdownRect := func(i int) rl.Rectangle {
+			return rl.Rectangle{
+				n.UIRect.X + float32(i)*(dropdownWidth+UIFieldSpacing),
+				n.UIRect.Y,
+				dropdownWidth,
+				UIFieldHeight,
+			}
+		}
+		doDropdown := func(dropdown *raygui.DropdownEx, bounds rl.Rectangle) interface{} {
+			if openDropdown == dropdown {
+				raygui.Enable()
+				defer raygui.Disable()
+			}
+			return dropdown.Do(bounds)
+		}
+
+		d.SplitCol, _ = doDropdown(&d.SplitColDropdown, dropdownRect(2)).(string)
+		d.Col, _ = doDropdown(&d.ColDropdown, dropdownRect(1)).(string)
+		d.Kind, _ = doDropdown(&d.KindDropdown, dropdownRect(0)).(DistributionKind)
+	}
+
+	// dragging
+	{
+		bottomRight := rl.Vector2{n.Pos.X + n.Size.X, n.Pos.Y + n.Size.Y}
+		resizeRect := rl.Rectangle{bottomRight.X - 20, bottomRight.Y - 20, 20, 20}
+
+		drawResizeHandle(bottomRight, n.Color)
+
+		resizeDragKey := fmt.Sprintf("resize: %p", d)
+		if tryStartDrag(resizeDragKey, resizeRect, rl.Vector2{}) {
+			d.StartSize = d.Size
+		}
+
+		if resizingThis, _, canceled := dragState(resizeDragKey); resizingThis {
+			if canceled {
+				d.Size = d.StartSize
+			} else {
+				newSize := rl.Vector2Add(d.StartSize, dragOffset())
+				if newSize.X < previewMinWidth {
+					newSize.X = previewMinWidth
+				}
+				if newSize.Y < previewMinHeight {
+					newSize.Y = previewMinHeight
+				}
+				d.Size = newSize
+			}
+		} else {
+			d.Size = rl.Vector2{n.UIRect.Width, n.UIRect.Height}
+		}
+	}
+}
+
+// Serialize Changes to any setting mean the summary has to be queried again.
+func (d *Distribution) Serialize() (res string, active bool) {
+	res += fmt.Sprintf("%d", d.Kind)
+	res += d.Col
+	res += d.SplitCol
+	res += fmt.Sprintf("%v", d.AutoBins)
+	res += d.BinCount
+	return res, d.BinCountTextbox.Active
+}
+
+func (d *Distribution) Dropdowns() []*raygui.DropdownEx {
+	return []*raygui.DropdownEx{&d.KindDropdown, &d.ColDropdown, &d.SplitColDropdown}
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var ExportColor = rl.NewColor(160, 200, 140, 255)
+
+type Export struct {
+	Settings ExportSettings
+}
+
+var _ NodeData = &Export{}
+
+func NewExport() *Node {
+	return &Node{
+		Title:   "Export",
+		CanSnap: true,
+		Color:   ExportColor,
+		Inputs:  make([]*Node, 1),
+		Data: &Export{
+			Settings: NewExportSettings(),
+		},
+	}
+}
+
+func (d *Export) Update(n *Node) {
+	n.UISize = rl.Vector2{480, 5*UIFieldHeight + 4*UIFieldSpacing}
+	d.Settings.Update()
+}
+
+func (d *Export) DoUI(n *Node) {
+	d.Settings.DoStackedUI(n.UIRect, func() string {
+		if n.Inputs[0] == nil {
+			return ""
+		}
+		return n.GenerateSql(false)
+	})
+}
+
+func (d *Export) Serialize() (string, bool) {
+	return "", false
+}
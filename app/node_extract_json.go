@@ -0,0 +1,397 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var ExtractJSONColor = rl.NewColor(230, 200, 110, 255)
+
+// How many rows to look at when discovering paths, and limits to keep the
+// list of paths manageable.
+const jsonSampleRows = 200
+const jsonMaxDepth = 4
+const jsonMaxPaths = 40
+
+// The alias of the json_each() table used to explode arrays.
+const jsonEachAlias = "je"
+
+type ExtractJSON struct {
+	Col     string
+	Explode string // path of an array to turn into rows, or "" for none
+	Paths   []*JSONPath
+
+	ColDropdown     raygui.DropdownEx
+	ExplodeDropdown raygui.DropdownEx
+
+	sampledSql string
+	sampledCol string
+}
+
+type JSONPath struct {
+	Path   string // e.g. $.address.city, or $.items[*].name for array elements
+	Type   string // INTEGER, REAL, or TEXT; empty if mixed or nested JSON
+	Array  bool   // whether any sampled value at this path was an array
+	Picked bool
+}
+
+func NewExtractJSON() *Node {
+	return &Node{
+		Title:   "Extract JSON",
+		CanSnap: true,
+		Color:   ExtractJSONColor,
+		Inputs:  make([]*Node, 1),
+		Data:    &ExtractJSON{},
+	}
+}
+
+// VisiblePaths Gets the paths that can be extracted with the current explode
+// setting: everything outside of arrays, plus the elements of the exploded
+// array.
+func (d *ExtractJSON) VisiblePaths() []*JSONPath {
+	var res []*JSONPath
+	for _, p := range d.Paths {
+		rest := p.Path
+		if d.Explode != "" && strings.HasPrefix(p.Path, d.Explode+"[*]") {
+			rest = strings.TrimPrefix(p.Path, d.Explode+"[*]")
+		}
+		if p.Path != "$" && !strings.Contains(rest, "[*]") {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// Expression Gets the SQL expression extracting a path from the row aliased as
+// src, cast to the path's type.
+func (d *ExtractJSON) Expression(p *JSONPath) string {
+	// json_extract fails the whole query on malformed JSON, so anything
+	// invalid is treated as NULL.
+	expr := fmt.Sprintf("json_extract(iif(json_valid(src.%s), src.%s, NULL), '%s')", d.Col, d.Col, p.Path)
+	if d.Explode != "" && strings.HasPrefix(p.Path, d.Explode+"[*]") {
+		elementPath := "$" + strings.TrimPrefix(p.Path, d.Explode+"[*]")
+		if elementPath == "$" {
+			expr = fmt.Sprintf("%s.value", jsonEachAlias)
+		} else {
+			expr = fmt.Sprintf("json_extract(%s.value, '%s')", jsonEachAlias, elementPath)
+		}
+	}
+
+	if p.Type != "" {
+		expr = fmt.Sprintf("CAST(%s AS %s)", expr, p.Type)
+	}
+	return expr
+}
+
+// ExplodeSource Gets the json_each() call producing one row per element of
+// the exploded array.
+func (d *ExtractJSON) ExplodeSource() string {
+	return fmt.Sprintf("json_each(iif(json_valid(src.%s), src.%s, NULL), '%s')", d.Col, d.Col, d.Explode)
+}
+
+// Columns Gets the extracted columns, named so they don't clash with the
+// input's columns or each other.
+func (d *ExtractJSON) Columns(inputSchema []string) []GenColumn {
+	taken := map[string]bool{}
+	for _, col := range inputSchema {
+		taken[strings.ToLower(col)] = true
+	}
+
+	var res []GenColumn
+	for _, p := range d.VisiblePaths() {
+		if !p.Picked {
+			continue
+		}
+
+		name := jsonPathColumnName(p.Path, d.Col)
+		unique := name
+		for suffix := 2; taken[strings.ToLower(unique)]; suffix++ {
+			unique = fmt.Sprintf("%s_%d", name, suffix)
+		}
+		taken[strings.ToLower(unique)] = true
+
+		res = append(res, GenColumn{Col: d.Expression(p), Alias: unique})
+	}
+	return res
+}
+
+// Turns a path like $.address.city into a column name like address_city. The
+// elements of an exploded array like $.tags[*] become tags_value.
+func jsonPathColumnName(path string, col string) string {
+	if strings.HasSuffix(path, "[*]") {
+		path += ".value"
+	}
+	path = strings.TrimPrefix(path, "$")
+	path = strings.ReplaceAll(path, "[*]", "")
+	path = strings.ReplaceAll(path, `"`, "")
+	path = strings.Trim(strings.ReplaceAll(path, ".", "_"), "_")
+	if path == "" {
+		return col
+	}
+	return csvColumnNames([]string{path})[0]
+}
+
+func (d *ExtractJSON) Dropdowns() []*raygui.DropdownEx {
+	return []*raygui.DropdownEx{&d.ColDropdown, &d.ExplodeDropdown}
+}
+
+func (d *ExtractJSON) Update(n *Node) {
+	colOpts := columnNameDropdownOpts(n.Inputs[0])
+	d.ColDropdown.SetOptions(colOpts...)
+
+	if n.Inputs[0] != nil && d.Col != "" {
+		inputSql := n.Inputs[0].GenerateSql(false)
+		if inputSql != d.sampledSql || d.Col != d.sampledCol {
+			d.sampledSql = inputSql
+			d.sampledCol = d.Col
+			d.discoverPaths(inputSql)
+		}
+	}
+
+	explodeOpts := []raygui.DropdownExOption{{"Don't explode", ""}}
+	for _, p := range d.Paths {
+		if p.Array && !strings.Contains(p.Path, "[*]") {
+			explodeOpts = append(explodeOpts, raygui.DropdownExOption{
+				Name:  fmt.Sprintf("Explode %s", p.Path),
+				Value: p.Path,
+			})
+		}
+	}
+	d.ExplodeDropdown.SetOptions(explodeOpts...)
+	d.ExplodeDropdown.SelectValue(d.Explode)
+
+	numPaths := len(d.VisiblePaths())
+	if numPaths == 0 {
+		numPaths = 1 // for the "nothing found" message
+	}
+	var height float32 = 2 * (UIFieldHeight + UIFieldSpacing)
+	height += float32(numPaths)*(UIFieldHeight+UIFieldSpacing) - UIFieldSpacing
+
+	n.UISize = rl.Vector2{500, height}
+}
+
+// Samples the column and rebuilds the list of paths, keeping whatever was
+// already picked.
+func (d *ExtractJSON) discoverPaths(inputSql string) {
+	picked := map[string]bool{}
+	for _, p := range d.Paths {
+		picked[p.Path] = p.Picked
+	}
+
+	values, err := sampleColumn(inputSql, d.Col, jsonSampleRows)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	d.Paths = discoverJSONPaths(values)
+	for _, p := range d.Paths {
+		p.Picked = picked[p.Path]
+	}
+}
+
+// Gets up to limit non-NULL values of a column, as text.
+func sampleColumn(query string, col string, limit int) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM (%s) WHERE %s IS NOT NULL LIMIT %d", col, query, col, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v.String)
+	}
+	return values, rows.Err()
+}
+
+/*
+Paths are found by walking every sampled value. Object keys are visited in
+sorted order so the list doesn't jump around between samples. Array elements
+all share one path ending in [*], since they can only be extracted by
+exploding the array.
+*/
+
+var jsonPlainKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func discoverJSONPaths(values []string) []*JSONPath {
+	var paths []*JSONPath
+	byPath := map[string]*JSONPath{}
+	kinds := map[string]map[string]bool{}
+
+	var walk func(v interface{}, path string, depth int)
+	walk = func(v interface{}, path string, depth int) {
+		p, ok := byPath[path]
+		if !ok {
+			if len(paths) >= jsonMaxPaths {
+				return
+			}
+			p = &JSONPath{Path: path}
+			byPath[path] = p
+			kinds[path] = map[string]bool{}
+			paths = append(paths, p)
+		}
+
+		switch val := v.(type) {
+		case map[string]interface{}:
+			kinds[path]["json"] = true
+			if depth >= jsonMaxDepth {
+				return
+			}
+			keys := make([]string, 0, len(val))
+			for key := range val {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if strings.ContainsAny(key, `"'`) {
+					continue // can't be written in a path
+				}
+				pathKey := key
+				if !jsonPlainKeyRegexp.MatchString(key) {
+					pathKey = `"` + key + `"`
+				}
+				walk(val[key], path+"."+pathKey, depth+1)
+			}
+		case []interface{}:
+			kinds[path]["json"] = true
+			p.Array = true
+			if depth >= jsonMaxDepth {
+				return
+			}
+			for _, elem := range val {
+				walk(elem, path+"[*]", depth+1)
+			}
+		case json.Number:
+			if _, err := val.Int64(); err == nil {
+				kinds[path]["int"] = true
+			} else {
+				kinds[path]["real"] = true
+			}
+		case bool:
+			kinds[path]["int"] = true // json_extract gives 0 or 1
+		case string:
+			kinds[path]["text"] = true
+		}
+	}
+
+	for _, value := range values {
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			continue
+		}
+		walk(v, "$", 0)
+	}
+
+	for _, p := range paths {
+		k := kinds[p.Path]
+		switch {
+		case k["json"] || len(k) == 0:
+			p.Type = ""
+		case k["text"]:
+			if len(k) == 1 {
+				p.Type = "TEXT"
+			}
+		case k["real"]:
+			p.Type = "REAL"
+		default:
+			p.Type = "INTEGER"
+		}
+	}
+
+	return paths
+}
+
+func (d *ExtractJSON) DoUI(n *Node) {
+	const labelWidth = 100 * zoomLevel
+	const typeWidth = 110 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldX := n.UIRect.X + labelWidth
+	fieldWidth := n.UIRect.Width - labelWidth
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	visible := d.VisiblePaths()
+	fieldY := n.UIRect.Y + 2*(UIFieldHeight+UIFieldSpacing)
+	if len(visible) == 0 {
+		msg := "Pick a column containing JSON."
+		if d.Col != "" {
+			msg = "No JSON found in this column."
+		}
+		drawBasicText(msg, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	}
+	for _, p := range visible {
+		label := p.Path
+		if d.Explode != "" && strings.HasPrefix(p.Path, d.Explode+"[*]") {
+			label = "each" + strings.TrimPrefix(p.Path, d.Explode+"[*]")
+		}
+		p.Picked = raygui.Toggle(rl.Rectangle{
+			n.UIRect.X,
+			fieldY,
+			n.UIRect.Width - typeWidth - UIFieldSpacing,
+			UIFieldHeight,
+		}, label, p.Picked)
+
+		typeName := strings.ToLower(p.Type)
+		if typeName == "" {
+			typeName = "json"
+		}
+		drawBasicText(typeName, n.UIRect.X+n.UIRect.Width-typeWidth, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+
+		fieldY += UIFieldHeight + UIFieldSpacing
+	}
+
+	fieldY = n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+	drawBasicText("Rows", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	func() {
+		if openDropdown == &d.ExplodeDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		explode := d.ExplodeDropdown.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight})
+		d.Explode, _ = explode.(string)
+	}()
+
+	fieldY = n.UIRect.Y
+	drawBasicText("Column", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	func() {
+		if openDropdown == &d.ColDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		col := d.ColDropdown.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight})
+		d.Col, _ = col.(string)
+	}()
+}
+
+func (d *ExtractJSON) Serialize() (res string, active bool) {
+	res += d.Col
+	res += d.Explode
+	for _, p := range d.Paths {
+		if p.Picked {
+			res += p.Path
+		}
+	}
+	return res, false
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var HierarchyColor = rl.NewColor(120, 190, 200, 255)
+
+const hierarchySourceName = "hierarchy_src"
+const hierarchyName = "hierarchy"
+const hierarchyDepthCol = "depth"
+const hierarchyPathCol = "path"
+
+// Guards against cycles in the parent references, which would otherwise
+// recurse forever.
+const hierarchyMaxDepth = 100
+
+type Hierarchy struct {
+	IdCol     string
+	ParentCol string
+	Roots     string // optional condition picking the root rows
+
+	IdColDropdown     raygui.DropdownEx
+	ParentColDropdown raygui.DropdownEx
+	RootsTextbox      raygui.TextBoxEx
+}
+
+func NewHierarchy() *Node {
+	return &Node{
+		Title:   "Hierarchy",
+		CanSnap: true,
+		Color:   HierarchyColor,
+		Inputs:  make([]*Node, 1),
+		Data:    &Hierarchy{},
+	}
+}
+
+// RootCondition Gets the condition for the top level of the tree. By default,
+// the roots are the rows without a parent.
+func (d *Hierarchy) RootCondition() string {
+	if strings.TrimSpace(d.Roots) == "" {
+		return fmt.Sprintf("src.%s IS NULL", d.ParentCol)
+	}
+	return d.Roots
+}
+
+func (d *Hierarchy) Dropdowns() []*raygui.DropdownEx {
+	return []*raygui.DropdownEx{&d.IdColDropdown, &d.ParentColDropdown}
+}
+
+func (d *Hierarchy) Update(n *Node) {
+	n.UISize = rl.Vector2{440, 3*UIFieldHeight + 2*UIFieldSpacing}
+
+	opts := columnNameDropdownOpts(n.Inputs[0])
+	d.IdColDropdown.SetOptions(opts...)
+	d.ParentColDropdown.SetOptions(opts...)
+}
+
+func (d *Hierarchy) DoUI(n *Node) {
+	const labelWidth = 100 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldX := n.UIRect.X + labelWidth
+	fieldWidth := n.UIRect.Width - labelWidth
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	fieldY := n.UIRect.Y + 2*(UIFieldHeight+UIFieldSpacing)
+	drawBasicText("Roots", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	d.Roots, _ = d.RootsTextbox.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight}, d.Roots, 100)
+
+	fieldY -= UIFieldHeight + UIFieldSpacing
+	drawBasicText("Parent", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	func() {
+		if openDropdown == &d.ParentColDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		parentCol := d.ParentColDropdown.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight})
+		d.ParentCol, _ = parentCol.(string)
+	}()
+
+	fieldY -= UIFieldHeight + UIFieldSpacing
+	drawBasicText("ID", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	func() {
+		if openDropdown == &d.IdColDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		idCol := d.IdColDropdown.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight})
+		d.IdCol, _ = idCol.(string)
+	}()
+}
+
+func (d *Hierarchy) Serialize() (res string, active bool) {
+	res += d.IdCol
+	res += d.ParentCol
+	res += d.Roots
+	return res, d.RootsTextbox.Active
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var ImportCSVColor = rl.NewColor(150, 170, 220, 255)
+
+type ImportCSV struct {
+	Path string
+	CSVImportOptions
+
+	PathTextbox      raygui.TextBoxEx
+	TableTextbox     raygui.TextBoxEx
+	EncodingDropdown raygui.DropdownEx
+
+	Import *CSVImport // non-nil while importing
+	Status string
+}
+
+var _ NodeData = &ImportCSV{}
+
+func NewImportCSV(path string) *Node {
+	return &Node{
+		Title:   "Import CSV",
+		CanSnap: false,
+		Color:   ImportCSVColor,
+		Data: &ImportCSV{
+			Path: path,
+			CSVImportOptions: CSVImportOptions{
+				Table:    csvTableName(path),
+				Header:   true,
+				Encoding: EncodingAuto,
+			},
+		},
+	}
+}
+
+// Suggests a table name based on the file name, e.g. "Sales 2021.csv"
+// becomes "sales_2021".
+func csvTableName(path string) string {
+	if path == "" {
+		return ""
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return csvColumnNames([]string{strings.ToLower(base)})[0]
+}
+
+func (d *ImportCSV) Update(n *Node) {
+	n.UISize = rl.Vector2{480, 5*UIFieldHeight + 4*UIFieldSpacing}
+	d.EncodingDropdown.SetOptions(csvEncodingOpts...)
+
+	if d.Import == nil {
+		return
+	}
+	_, rows, done, err := d.Import.Progress()
+	if !done {
+		return
+	}
+
+	d.Import = nil
+	if err != nil {
+		d.Status = err.Error()
+		return
+	}
+
+	// The import node has done its job; swap it out for the new table.
+	d.Status = fmt.Sprintf("Imported %d rows.", rows)
+	refreshTableDropdowns()
+	clearAllSchemas()
+
+	table := NewTable()
+	table.Data.(*Table).Table = d.Table
+	table.Pos = n.Pos
+	table.Sort = n.Sort
+	replaceNode(n, table)
+	table.Update()
+}
+
+func (d *ImportCSV) DoUI(n *Node) {
+	const tempWidth = 100 * zoomLevel
+	const textSize = 20
+
+	dropdownOpen := d.EncodingDropdown.Open
+	if dropdownOpen || d.Import != nil {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	halfWidth := n.UIRect.Width/2 - UIFieldSpacing/2
+	rightX := n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2
+
+	fieldY := n.UIRect.Y
+	path, _ := d.PathTextbox.Do(rl.Rectangle{n.UIRect.X, fieldY, n.UIRect.Width, UIFieldHeight}, d.Path, 200)
+	if path != d.Path && (d.Table == "" || d.Table == csvTableName(d.Path)) {
+		d.Table = csvTableName(path)
+	}
+	d.Path = path
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	d.Table, _ = d.TableTextbox.Do(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width - tempWidth - UIFieldSpacing,
+		UIFieldHeight,
+	}, d.Table, 100)
+	d.Temp = raygui.Toggle(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width - tempWidth,
+		fieldY,
+		tempWidth,
+		UIFieldHeight,
+	}, "Temp", d.Temp)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	// The dropdown is drawn last so its list ends up on top.
+	encodingY := fieldY
+	d.Header = raygui.Toggle(rl.Rectangle{rightX, fieldY, halfWidth, UIFieldHeight}, "Header row", d.Header)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	if d.Import != nil {
+		frac, rows, _, _ := d.Import.Progress()
+		bar := rl.Rectangle{n.UIRect.X, fieldY, n.UIRect.Width, UIFieldHeight}
+		rl.DrawRectangleRec(bar, rl.ColorAlpha(rl.Black, 0.15))
+		rl.DrawRectangleRec(rl.Rectangle{bar.X, bar.Y, bar.Width * frac, bar.Height}, Brightness(n.Color, 0.7))
+		rl.DrawRectangleLinesEx(bar, 2, Brightness(n.Color, 0.45))
+		drawBasicText(
+			fmt.Sprintf("%d%% - %d rows", int(frac*100), rows),
+			bar.X+UIFieldSpacing, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black,
+		)
+	} else {
+		drawBasicText(d.Status, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	}
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	if raygui.Button(rl.Rectangle{n.UIRect.X, fieldY, n.UIRect.Width, UIFieldHeight}, "Import") {
+		if strings.TrimSpace(d.Path) == "" {
+			d.Status = "Enter a file name."
+		} else if err := validateTableName(d.Table); err != nil {
+			d.Status = err.Error()
+		} else {
+			d.Status = ""
+			d.Import = startCSVImport(d.Path, d.CSVImportOptions)
+		}
+	}
+
+	func() {
+		if dropdownOpen {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		encoding := d.EncodingDropdown.Do(rl.Rectangle{n.UIRect.X, encodingY, halfWidth, UIFieldHeight})
+		d.Encoding, _ = encoding.(CSVEncoding)
+	}()
+}
+
+// Nothing downstream depends on the import settings, so there is never
+// anything to update.
+func (d *ImportCSV) Serialize() (string, bool) {
+	return "", false
+}
+
+// Puts a new node in place of an old one, rewiring anything that used the old
+// node as an input.
+func replaceNode(old, new *Node) {
+	for i, n := range nodes {
+		if n == old {
+			nodes[i] = new
+		}
+		for k, input := range n.Inputs {
+			if input == old {
+				n.Inputs[k] = new
+			}
+		}
+	}
+	if selectedNode == old {
+		selectedNode = new
+	}
+}
+
+// Creates an Import CSV node for each CSV file dropped onto the window.
+func handleDroppedFiles() {
+	if !rl.IsFileDropped() {
+		return
+	}
+
+	var count int32
+	files := rl.GetDroppedFiles(&count)
+	pos := rl.GetScreenToWorld2D(rl.GetMousePosition(), cam)
+	for _, file := range files {
+		if !strings.EqualFold(filepath.Ext(file), ".csv") {
+			continue
+		}
+		n := NewImportCSV(file)
+		n.Pos = pos
+		n.Sort = nodeSortTop()
+		nodes = append(nodes, n)
+
+		pos = rl.Vector2Add(pos, rl.Vector2{30, 30})
+	}
+	rl.ClearDroppedFiles()
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -13,26 +14,54 @@ type Join struct {
 	FirstAlias        string
 	FirstAliasTextbox raygui.TextBoxEx
 	Conditions        []*JoinCondition
+
+	Status string // set during Update if the join can't be generated
+
+	StatsJob *JoinStatsJob // nil until every input is hooked up
+	statsSql string
 }
 
 type JoinCondition struct {
 	Alias            string
-	Condition        string
+	Mode             JoinMode
+	Condition        string // the ON condition, or the USING column list
 	Left             bool
 	Right            bool
 	AliasTextBox     raygui.TextBoxEx
+	ModeDropdown     raygui.DropdownEx
 	ConditionTextBox raygui.TextBoxEx
 }
 
+// Match statistics take two short rows under each condition.
+const joinStatsRowHeight = 26 * zoomLevel
+const joinStatsHeight = 2*joinStatsRowHeight + UIFieldSpacing
+
 type JoinType int
 
 const (
 	LeftJoin JoinType = iota + 1
 	RightJoin
 	InnerJoin
-	OuterJoin
+	FullJoin
+	CrossJoin
+)
+
+type JoinMode int
+
+const (
+	JoinOn JoinMode = iota
+	JoinUsing
+	JoinNatural
+	JoinCross
 )
 
+var joinModeOpts = []raygui.DropdownExOption{
+	{"ON", JoinOn},
+	{"USING", JoinUsing},
+	{"NATURAL", JoinNatural},
+	{"CROSS", JoinCross},
+}
+
 func NewJoin() *Node {
 	return &Node{
 		Title:   "Join",
@@ -46,8 +75,10 @@ func NewJoin() *Node {
 }
 
 func (jc *JoinCondition) Type() JoinType {
-	if jc.Left && jc.Right {
-		return OuterJoin
+	if jc.Mode == JoinCross {
+		return CrossJoin
+	} else if jc.Left && jc.Right {
+		return FullJoin
 	} else if jc.Left {
 		return LeftJoin
 	} else if jc.Right {
@@ -65,13 +96,40 @@ func (jt JoinType) String() string {
 		return "RIGHT JOIN"
 	case InnerJoin:
 		return "JOIN"
-	case OuterJoin:
-		return "OUTER JOIN"
+	case FullJoin:
+		return "FULL OUTER JOIN"
+	case CrossJoin:
+		return "CROSS JOIN"
 	default:
 		return "BAD JOIN"
 	}
 }
 
+// UsingCols Gets the columns listed for a USING join.
+func (jc *JoinCondition) UsingCols() []string {
+	var cols []string
+	for _, col := range strings.Split(jc.Condition, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// NeedsEmulation Whether this join has to be rewritten because SQLite is too
+// old to do it natively. RIGHT and FULL joins arrived in SQLite 3.39.
+func (jt JoinType) NeedsEmulation() bool {
+	return (jt == RightJoin || jt == FullJoin) && !sqliteVersionAtLeast(3, 39, 0)
+}
+
+func (d *Join) Dropdowns() []*raygui.DropdownEx {
+	res := make([]*raygui.DropdownEx, len(d.Conditions))
+	for i, cond := range d.Conditions {
+		res[i] = &cond.ModeDropdown
+	}
+	return res
+}
+
 func (d *Join) Update(n *Node) {
 	n.InputPinHeights = make([]int, len(n.Inputs))
 
@@ -86,19 +144,89 @@ func (d *Join) Update(n *Node) {
 		n.InputPinHeights[i+1] = int(uiHeight)
 		uiHeight += UIFieldHeight + UIFieldSpacing   // alias field
 		uiHeight += UIFieldHeight + 2*UIFieldSpacing // condition field
+		if d.StatsJob != nil {
+			uiHeight += joinStatsHeight
+		}
 
 		cond := d.Conditions[i]
 		if cond.Alias == "" && !cond.AliasTextBox.Active {
 			cond.Alias = string(rune('b' + i))
 		}
+		cond.ModeDropdown.SetOptions(joinModeOpts...)
+	}
+
+	d.Status = ""
+	numEmulated := 0
+	for i, input := range n.Inputs[1:] {
+		if input != nil && d.Conditions[i].Type().NeedsEmulation() {
+			numEmulated++
+		}
+	}
+	if n.Inputs[0] != nil && numEmulated > 1 {
+		d.Status = "Only one RIGHT or FULL join is supported."
 	}
 
 	uiHeight += UIFieldHeight // +/- buttons
+	if d.Status != "" {
+		uiHeight += UIFieldSpacing + UIFieldHeight
+	}
+
+	n.UISize = rl.Vector2{640, float32(uiHeight)}
 
-	n.UISize = rl.Vector2{560, float32(uiHeight)}
+	if n.Schema == nil {
+		d.updateStats(n)
+		n.Schema = getSchema(n)
+	}
+}
+
+// Starts counting matches again whenever the join changes. Schemas are
+// cleared whenever any node changes, so this only runs then.
+func (d *Join) updateStats(n *Node) {
+	if _, active := d.Serialize(); active {
+		return
+	}
+
+	var queries []joinStatsQuery
+	var statsSql string
+	if allInputsConnected(n) {
+		queries = joinStatsQueries(n, d)
+		for _, q := range queries {
+			statsSql += q.Counts + ";\n"
+		}
+	}
+	if statsSql == d.statsSql {
+		return
+	}
+
+	if d.StatsJob != nil {
+		d.StatsJob.Cancel()
+		d.StatsJob = nil
+	}
+	d.statsSql = statsSql
+	if len(queries) > 0 {
+		d.StatsJob = startJoinStats(queries, joinStatsConn(queries))
+	}
+}
+
+func allInputsConnected(n *Node) bool {
+	for _, input := range n.Inputs {
+		if input == nil {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *Join) DoUI(n *Node) {
+	const modeWidth = 140 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
 	fieldY := n.UIRect.Y
 
 	// first alias
@@ -117,42 +245,61 @@ func (d *Join) DoUI(n *Node) {
 	uiRight := n.UIRect.X + n.UIRect.Width
 	boxWidth := n.UIRect.Width - (UIFieldSpacing+UIFieldHeight)*2
 
-	for _, condition := range d.Conditions {
-		// alias
+	// The mode dropdowns are drawn last so their lists end up on top.
+	modeRects := make([]rl.Rectangle, len(d.Conditions))
+
+	for i, condition := range d.Conditions {
+		// alias and mode
 		aliasRect := rl.Rectangle{
 			n.UIRect.X,
 			float32(fieldY),
-			n.UIRect.Width,
+			n.UIRect.Width - modeWidth - UIFieldSpacing,
 			UIFieldHeight,
 		}
 		condition.Alias, _ = condition.AliasTextBox.Do(aliasRect, condition.Alias, 100)
+		modeRects[i] = rl.Rectangle{uiRight - modeWidth, fieldY, modeWidth, UIFieldHeight}
 
 		fieldY += UIFieldHeight + UIFieldSpacing
 
 		// condition
-		conditionRect := rl.Rectangle{
-			n.UIRect.X,
-			float32(fieldY),
-			boxWidth,
-			UIFieldHeight,
-		}
-		condition.Condition, _ = condition.ConditionTextBox.Do(conditionRect, condition.Condition, 100)
-		condition.Left = raygui.Toggle(rl.Rectangle{
-			uiRight - (UIFieldHeight + UIFieldSpacing + UIFieldHeight),
-			float32(fieldY),
-			UIFieldHeight,
-			UIFieldHeight,
-		}, "L", condition.Left)
-		raygui.Disable() // lol thank you sqlite
-		{
+		func() {
+			if condition.Mode == JoinNatural || condition.Mode == JoinCross {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+
+			conditionRect := rl.Rectangle{
+				n.UIRect.X,
+				float32(fieldY),
+				boxWidth,
+				UIFieldHeight,
+			}
+			condition.Condition, _ = condition.ConditionTextBox.Do(conditionRect, condition.Condition, 100)
+		}()
+		func() {
+			if condition.Mode == JoinCross {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+
+			condition.Left = raygui.Toggle(rl.Rectangle{
+				uiRight - (UIFieldHeight + UIFieldSpacing + UIFieldHeight),
+				float32(fieldY),
+				UIFieldHeight,
+				UIFieldHeight,
+			}, "L", condition.Left)
 			condition.Right = raygui.Toggle(rl.Rectangle{
 				uiRight - UIFieldHeight,
 				float32(fieldY),
 				UIFieldHeight,
 				UIFieldHeight,
 			}, "R", condition.Right)
+		}()
+
+		if d.StatsJob != nil {
+			d.doStatsUI(i, fieldY+UIFieldHeight+UIFieldSpacing, n.UIRect.X, uiRight)
+			fieldY += joinStatsHeight
 		}
-		raygui.Enable()
 
 		fieldY += UIFieldHeight + 2*UIFieldSpacing
 	}
@@ -175,6 +322,74 @@ func (d *Join) DoUI(n *Node) {
 		if len(d.Conditions) > 1 {
 			n.Inputs = n.Inputs[:len(n.Inputs)-1]
 			d.Conditions = d.Conditions[:len(d.Conditions)-1]
+			modeRects = modeRects[:len(modeRects)-1]
+		}
+	}
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	drawBasicText(d.Status, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+
+	for i := len(modeRects) - 1; i >= 0; i-- {
+		func() {
+			cond := d.Conditions[i]
+			if openDropdown == &cond.ModeDropdown {
+				raygui.Enable()
+				defer raygui.Disable()
+			}
+			mode := cond.ModeDropdown.Do(modeRects[i])
+			cond.Mode, _ = mode.(JoinMode)
+		}()
+	}
+}
+
+// Shows how the rows on either side of a condition matched up. Clicking an
+// unmatched count shows those rows.
+func (d *Join) doStatsUI(condIndex int, y float32, left float32, right float32) {
+	const textSize = 20
+
+	stats, done, err := d.StatsJob.Result()
+	if condIndex >= len(stats) {
+		status := "Counting matches..."
+		if done && err != nil {
+			status = "Couldn't count matches."
+		}
+		drawBasicText(status, left, y+(joinStatsRowHeight-textSize)/2, textSize, rl.Black)
+		return
+	}
+	s := stats[condIndex]
+
+	// The left side is everything joined so far.
+	leftLabel := d.FirstAlias
+	for _, cond := range d.Conditions[:condIndex] {
+		leftLabel += "+" + cond.Alias
+	}
+
+	sides := []struct {
+		Label        string
+		Rows         int64
+		Matched      int64
+		FanOut       float64
+		UnmatchedSql string
+	}{
+		{leftLabel, s.LeftRows, s.LeftMatched, s.LeftFanOut(), s.LeftUnmatchedSql},
+		{d.Conditions[condIndex].Alias, s.RightRows, s.RightMatched, s.RightFanOut(), s.RightUnmatchedSql},
+	}
+	for i, side := range sides {
+		textY := y + float32(i)*joinStatsRowHeight + (joinStatsRowHeight-textSize)/2
+
+		matched := fmt.Sprintf("%s: %d matched", side.Label, side.Matched)
+		if side.FanOut > 1 {
+			matched += fmt.Sprintf(" x%.2f", side.FanOut)
+		}
+		drawBasicText(matched, left, textY, textSize, rl.Black)
+
+		unmatchedCount := side.Rows - side.Matched
+		unmatched := fmt.Sprintf("%d unmatched", unmatchedCount)
+		unmatchedX := right - measureBasicText(unmatched, textSize).X
+		if unmatchedCount == 0 {
+			drawBasicText(unmatched, unmatchedX, textY, textSize, rl.Black)
+		} else if doLinkText(unmatched, unmatchedX, textY, textSize, rl.DarkBlue) {
+			ShowQueryInInspector(side.UnmatchedSql)
 		}
 	}
 }
@@ -186,6 +401,7 @@ func (j *Join) Serialize() (res string, active bool) {
 	}
 	for _, cond := range j.Conditions {
 		res += cond.Alias
+		res += fmt.Sprintf("%d", cond.Mode)
 		res += cond.Condition
 		res += fmt.Sprintf("%v", cond.Left)
 		res += fmt.Sprintf("%v", cond.Right)
@@ -9,16 +9,62 @@ import (
 
 var SortColor = rl.NewColor(255, 204, 128, 255)
 
-const sortDirectionWidth = 50
+const sortDirectionWidth = 120 * zoomLevel
 
 type Sort struct {
 	Cols []*SortColumn
+
+	colKinds map[string]ColumnKind
 }
 
 type SortColumn struct {
-	Col         string
-	Descending  bool
-	ColDropdown raygui.DropdownEx
+	Col        string
+	Descending bool
+	Nulls      NullsOrder
+	NoCase     bool // ignore case when sorting text
+
+	// Sort by an SQL expression instead of a column.
+	IsExpression bool
+	Expression   string
+
+	ColDropdown       raygui.DropdownEx
+	NullsDropdown     raygui.DropdownEx
+	ExpressionTextbox raygui.TextBoxEx
+}
+
+type NullsOrder int
+
+const (
+	NullsDefault NullsOrder = iota
+	NullsFirst
+	NullsLast
+)
+
+var nullsOrderOpts = []raygui.DropdownExOption{
+	{"NULLs: default", NullsDefault},
+	{"NULLs first", NullsFirst},
+	{"NULLs last", NullsLast},
+}
+
+// sortDirectionLabel Describes a sort direction in terms that suit the data,
+// e.g. "1-9" for numbers.
+func sortDirectionLabel(kind ColumnKind, known bool, descending bool) string {
+	labels := [2]string{"Asc", "Desc"}
+	if known {
+		switch kind {
+		case KindNumber:
+			labels = [2]string{"1-9", "9-1"}
+		case KindDate:
+			labels = [2]string{"Old-New", "New-Old"}
+		default:
+			labels = [2]string{"A-Z", "Z-A"}
+		}
+	}
+
+	if descending {
+		return labels[1]
+	}
+	return labels[0]
 }
 
 func NewSort() *Node {
@@ -41,24 +87,39 @@ func (oc *Sort) ColDropdowns() []*raygui.DropdownEx {
 	return res
 }
 
+func (oc *Sort) Dropdowns() []*raygui.DropdownEx {
+	res := oc.ColDropdowns()
+	for _, col := range oc.Cols {
+		res = append(res, &col.NullsDropdown)
+	}
+	return res
+}
+
 func (d *Sort) Update(n *Node) {
 	uiHeight := 0
 	for range d.Cols {
-		uiHeight += UIFieldHeight
-		uiHeight += UIFieldSpacing
+		uiHeight += 2 * UIFieldHeight  // column, then options
+		uiHeight += 3 * UIFieldSpacing // with extra space between sorts
 	}
 	uiHeight += UIFieldHeight // for buttons
 
-	n.UISize = rl.Vector2{300, float32(uiHeight)}
+	n.UISize = rl.Vector2{560, float32(uiHeight)}
 
 	opts := columnNameDropdownOpts(n.Inputs[0])
 	for _, col := range d.Cols {
 		col.ColDropdown.SetOptions(opts...)
+		col.NullsDropdown.SetOptions(nullsOrderOpts...)
+		col.NullsDropdown.SelectValue(col.Nulls)
+	}
+
+	d.colKinds = nil
+	if n.Inputs[0] != nil {
+		d.colKinds = getColumnKinds(n.Inputs[0])
 	}
 }
 
 func (d *Sort) DoUI(n *Node) {
-	openDropdown, isOpen := raygui.GetOpenDropdown(d.ColDropdowns())
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
 	if isOpen {
 		raygui.Disable()
 		defer raygui.Enable()
@@ -87,43 +148,80 @@ func (d *Sort) DoUI(n *Node) {
 	}
 
 	for i := len(d.Cols) - 1; i >= 0; i-- {
-		func() {
-			fieldY -= UIFieldSpacing + UIFieldHeight
+		col := d.Cols[i]
 
-			col := d.Cols[i]
-			dropdown := &col.ColDropdown
-
-			if openDropdown == &col.ColDropdown {
+		// options
+		fieldY -= UIFieldSpacing + UIFieldHeight
+		func() {
+			if openDropdown == &col.NullsDropdown {
 				raygui.Enable()
 				defer raygui.Disable()
 			}
 
-			colName := dropdown.Do(rl.Rectangle{
+			nulls := col.NullsDropdown.Do(rl.Rectangle{
 				n.UIRect.X,
 				fieldY,
-				n.UIRect.Width - sortDirectionWidth - UIFieldSpacing,
+				n.UIRect.Width/2 - UIFieldSpacing/2,
 				UIFieldHeight,
 			})
-			col.Col, _ = colName.(string)
+			col.Nulls, _ = nulls.(NullsOrder)
+		}()
+		col.NoCase = raygui.Toggle(rl.Rectangle{
+			n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+			fieldY,
+			n.UIRect.Width/2 - UIFieldSpacing/2,
+			UIFieldHeight,
+		}, "Ignore case", col.NoCase)
+
+		// column or expression
+		fieldY -= UIFieldSpacing + UIFieldHeight
+		func() {
+			col.IsExpression = raygui.Toggle(rl.Rectangle{
+				n.UIRect.X,
+				fieldY,
+				UIFieldHeight,
+				UIFieldHeight,
+			}, "fx", col.IsExpression)
 
-			directionStr := "A-Z"
-			if col.Descending {
-				directionStr = "Z-A"
+			colRect := rl.Rectangle{
+				n.UIRect.X + UIFieldHeight + UIFieldSpacing,
+				fieldY,
+				n.UIRect.Width - UIFieldHeight - sortDirectionWidth - 2*UIFieldSpacing,
+				UIFieldHeight,
 			}
+			if col.IsExpression {
+				col.Expression, _ = col.ExpressionTextbox.Do(colRect, col.Expression, 200)
+			} else {
+				if openDropdown == &col.ColDropdown {
+					raygui.Enable()
+					defer raygui.Disable()
+				}
+
+				colName := col.ColDropdown.Do(colRect)
+				col.Col, _ = colName.(string)
+			}
+
+			kind, known := d.colKinds[col.Col]
 			col.Descending = raygui.Toggle(rl.Rectangle{
 				n.UIRect.X + n.UIRect.Width - sortDirectionWidth,
 				fieldY,
 				sortDirectionWidth,
 				UIFieldHeight,
-			}, directionStr, col.Descending)
+			}, sortDirectionLabel(kind, known && !col.IsExpression, col.Descending), col.Descending)
 		}()
+
+		fieldY -= UIFieldSpacing
 	}
 }
 
 func (d *Sort) Serialize() (res string, active bool) {
 	for _, col := range d.Cols {
 		res += col.Col
-		res += fmt.Sprintf("%v", col.Descending)
+		res += fmt.Sprintf("%v%d%v%v", col.Descending, col.Nulls, col.NoCase, col.IsExpression)
+		res += col.Expression
+		if col.ExpressionTextbox.Active {
+			active = true
+		}
 	}
-	return res, false
+	return res, active
 }
@@ -1,6 +1,10 @@
 package app
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -8,7 +12,18 @@ import (
 var PickColumnsColor = rl.NewColor(255, 122, 125, 255)
 
 type PickColumns struct {
+	// The columns to pick, in order. The checklist and exclude modes keep
+	// this up to date, so codegen only ever looks at the entries.
 	Entries []*PickColumnsEntry
+
+	Checklist bool     // tick columns off a list instead of adding a dropdown for each
+	Exclude   bool     // in checklist mode, pick every column except the ticked ones
+	Excluded  []string // the ticked columns in exclude mode
+
+	RenamePattern  RenamePattern
+	RenameArg      string
+	RenameDropdown raygui.DropdownEx
+	RenameTextbox  raygui.TextBoxEx
 }
 
 type PickColumnsEntry struct {
@@ -18,6 +33,26 @@ type PickColumnsEntry struct {
 	AliasTextbox raygui.TextBoxEx
 }
 
+type RenamePattern int
+
+const (
+	RenamePrefix RenamePattern = iota
+	RenameSuffix
+	RenameSnakeCase
+	RenameClear
+)
+
+var renamePatternOpts = []raygui.DropdownExOption{
+	{"Prefix", RenamePrefix},
+	{"Suffix", RenameSuffix},
+	{"snake_case", RenameSnakeCase},
+	{"No alias", RenameClear},
+}
+
+func (rp RenamePattern) HasArg() bool {
+	return rp == RenamePrefix || rp == RenameSuffix
+}
+
 func NewPickColumns() *Node {
 	return &Node{
 		Title:   "Pick Columns",
@@ -54,82 +89,388 @@ func (pc *PickColumns) ColDropdowns() []*raygui.DropdownEx {
 	return res
 }
 
+func (pc *PickColumns) Dropdowns() []*raygui.DropdownEx {
+	res := []*raygui.DropdownEx{&pc.RenameDropdown}
+	if !pc.Checklist {
+		res = append(res, pc.ColDropdowns()...)
+	}
+	return res
+}
+
+func (pc *PickColumns) entry(col string) *PickColumnsEntry {
+	for _, entry := range pc.Entries {
+		if entry.Col == col {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (pc *PickColumns) isExcluded(col string) bool {
+	for _, excluded := range pc.Excluded {
+		if excluded == col {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPicked Adds or removes a column in checklist mode.
+func (pc *PickColumns) SetPicked(col string, picked bool) {
+	if pc.Exclude {
+		var excluded []string
+		for _, other := range pc.Excluded {
+			if other != col {
+				excluded = append(excluded, other)
+			}
+		}
+		if !picked {
+			excluded = append(excluded, col)
+		}
+		pc.Excluded = excluded
+	}
+
+	if picked && pc.entry(col) == nil {
+		pc.Entries = append(pc.Entries, &PickColumnsEntry{Col: col})
+	} else if !picked {
+		var entries []*PickColumnsEntry
+		for _, entry := range pc.Entries {
+			if entry.Col != col {
+				entries = append(entries, entry)
+			}
+		}
+		pc.Entries = entries
+	}
+}
+
+// syncChecklist Brings the entries in line with the input columns. Columns
+// that disappeared are dropped, and in exclude mode, new columns are picked
+// automatically.
+func (pc *PickColumns) syncChecklist(schema []string) {
+	if len(schema) == 0 {
+		// Probably a broken input; don't throw away the user's picks.
+		return
+	}
+
+	inSchema := map[string]bool{}
+	for _, col := range schema {
+		inSchema[col] = true
+	}
+
+	var entries []*PickColumnsEntry
+	for _, entry := range pc.Entries {
+		if inSchema[entry.Col] && !(pc.Exclude && pc.isExcluded(entry.Col)) {
+			entries = append(entries, entry)
+		}
+	}
+	pc.Entries = entries
+
+	if pc.Exclude {
+		for _, col := range schema {
+			if pc.entry(col) == nil && !pc.isExcluded(col) {
+				pc.Entries = append(pc.Entries, &PickColumnsEntry{Col: col})
+			}
+		}
+	}
+}
+
+// checklistCols Gets the columns to show in checklist mode: the picked ones
+// in order, then the rest in the same order as the input.
+func (pc *PickColumns) checklistCols(schema []string) []string {
+	res := pc.Cols()
+	for _, col := range schema {
+		if pc.entry(col) == nil {
+			res = append(res, col)
+		}
+	}
+	return res
+}
+
+// Rename Applies a renaming pattern to every picked column. Patterns apply to
+// the current names, so they can be combined, e.g. snake_case and then a
+// prefix.
+func (pc *PickColumns) Rename(pattern RenamePattern, arg string) {
+	for _, entry := range pc.Entries {
+		if entry.Col == "" {
+			continue
+		}
+
+		name := entry.Alias
+		if name == "" {
+			name = entry.Col
+		}
+		switch pattern {
+		case RenamePrefix:
+			name = arg + name
+		case RenameSuffix:
+			name = name + arg
+		case RenameSnakeCase:
+			name = snakeCase(name)
+		case RenameClear:
+			name = entry.Col
+		}
+
+		if name == entry.Col {
+			name = ""
+		}
+		entry.Alias = name
+	}
+}
+
+// snakeCase Turns names like "FirstName", "first name", or "HTTPStatus" into
+// "first_name", "first_name", and "http_status".
+func snakeCase(s string) string {
+	runes := []rune(strings.TrimSpace(s))
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			endOfAcronym := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || endOfAcronym {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	parts := strings.FieldsFunc(nonIdentifierRegexp.ReplaceAllString(b.String(), "_"), func(r rune) bool {
+		return r == '_'
+	})
+	return strings.Join(parts, "_")
+}
+
+func (pc *PickColumns) moveEntry(from, to int) {
+	entry := pc.Entries[from]
+	pc.Entries = append(pc.Entries[:from], pc.Entries[from+1:]...)
+	pc.Entries = append(pc.Entries[:to], append([]*PickColumnsEntry{entry}, pc.Entries[to:]...)...)
+}
+
 func (p *PickColumns) Update(n *Node) {
+	var schema []string
+	if p.Checklist && n.Inputs[0] != nil {
+		schema = getSchema(n.Inputs[0])
+		p.syncChecklist(schema)
+	}
+
+	rows := len(p.Entries)
+	if p.Checklist {
+		rows = len(p.checklistCols(schema))
+	}
+	rows += 3 // mode toggles, buttons, and renaming
+
 	uiHeight := 0
-	for range p.Entries {
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			uiHeight += UIFieldSpacing
+		}
 		uiHeight += UIFieldHeight
-		uiHeight += UIFieldSpacing
 	}
-	uiHeight += UIFieldHeight // for buttons
 
-	n.UISize = rl.Vector2{400, float32(uiHeight)}
+	n.UISize = rl.Vector2{480, float32(uiHeight)}
 
 	opts := columnNameDropdownOpts(n.Inputs[0])
 	for _, entry := range p.Entries {
 		if len(opts) > 0 {
 			entry.ColDropdown.SetOptions(opts...)
+			entry.ColDropdown.SelectValue(entry.Col)
 		}
 	}
+	p.RenameDropdown.SetOptions(renamePatternOpts...)
+	p.RenameDropdown.SelectValue(p.RenamePattern)
 }
 
 func (p *PickColumns) DoUI(n *Node) {
-	openDropdown, isOpen := raygui.GetOpenDropdown(p.ColDropdowns())
+	const handleWidth = 24 * zoomLevel
+	const checkboxSize = 24 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(p.Dropdowns())
 	if isOpen {
 		raygui.Disable()
 		defer raygui.Enable()
 	}
 
+	halfWidth := n.UIRect.Width/2 - UIFieldSpacing/2
+	rightX := n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2
+
+	var schema []string
+	if p.Checklist && n.Inputs[0] != nil {
+		schema = getSchema(n.Inputs[0])
+	}
+
 	// Render bottom to top to avoid overlap issues with dropdowns
 
 	fieldY := n.UIRect.Y + n.UIRect.Height - UIFieldHeight
-	if raygui.Button(rl.Rectangle{
-		n.UIRect.X,
-		fieldY,
-		n.UIRect.Width/2 - UIFieldSpacing/2,
-		UIFieldHeight,
-	}, "+") {
-		p.Entries = append(p.Entries, &PickColumnsEntry{})
-	}
-	if raygui.Button(rl.Rectangle{
-		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
-		fieldY,
-		n.UIRect.Width/2 - UIFieldSpacing/2,
-		UIFieldHeight,
-	}, "-") {
-		if len(p.Entries) > 1 {
-			p.Entries = p.Entries[:len(p.Entries)-1]
-		}
-	}
-
-	for i := len(p.Entries) - 1; i >= 0; i-- {
-		fieldY -= UIFieldSpacing + UIFieldHeight
+	{
+		thirdWidth := (n.UIRect.Width - 2*UIFieldSpacing) / 3
 		func() {
-			entry := p.Entries[i]
-			if openDropdown == &entry.ColDropdown {
+			if openDropdown == &p.RenameDropdown {
 				raygui.Enable()
 				defer raygui.Disable()
 			}
-
-			col := entry.ColDropdown.Do(rl.Rectangle{
-				n.UIRect.X,
+			pattern := p.RenameDropdown.Do(rl.Rectangle{n.UIRect.X, fieldY, thirdWidth, UIFieldHeight})
+			p.RenamePattern, _ = pattern.(RenamePattern)
+		}()
+		func() {
+			if !p.RenamePattern.HasArg() {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			p.RenameArg, _ = p.RenameTextbox.Do(rl.Rectangle{
+				n.UIRect.X + thirdWidth + UIFieldSpacing,
 				fieldY,
-				n.UIRect.Width/2 - UIFieldSpacing/2,
+				thirdWidth,
 				UIFieldHeight,
-			})
-			entry.Col, _ = col.(string)
+			}, p.RenameArg, 100)
+		}()
+		if raygui.Button(rl.Rectangle{
+			n.UIRect.X + 2*(thirdWidth+UIFieldSpacing),
+			fieldY,
+			thirdWidth,
+			UIFieldHeight,
+		}, "Rename") {
+			p.Rename(p.RenamePattern, p.RenameArg)
+		}
+	}
 
-			aliasRect := rl.Rectangle{
-				n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
-				fieldY,
-				n.UIRect.Width/2 - UIFieldSpacing/2,
-				UIFieldHeight,
+	fieldY -= UIFieldSpacing + UIFieldHeight
+	if p.Checklist {
+		if raygui.Button(rl.Rectangle{n.UIRect.X, fieldY, halfWidth, UIFieldHeight}, "All") {
+			for _, col := range schema {
+				p.SetPicked(col, !p.Exclude)
+			}
+		}
+		if raygui.Button(rl.Rectangle{rightX, fieldY, halfWidth, UIFieldHeight}, "None") {
+			for _, col := range schema {
+				p.SetPicked(col, p.Exclude)
+			}
+		}
+	} else {
+		if raygui.Button(rl.Rectangle{n.UIRect.X, fieldY, halfWidth, UIFieldHeight}, "+") {
+			p.Entries = append(p.Entries, &PickColumnsEntry{})
+		}
+		if raygui.Button(rl.Rectangle{rightX, fieldY, halfWidth, UIFieldHeight}, "-") {
+			if len(p.Entries) > 1 {
+				p.Entries = p.Entries[:len(p.Entries)-1]
 			}
+		}
+	}
+
+	// Picked columns come first in both modes, so entry i is always on row i.
+	cols := p.Cols()
+	if p.Checklist {
+		cols = p.checklistCols(schema)
+	}
+	listTop := n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+	rowRect := func(i int) rl.Rectangle {
+		return rl.Rectangle{n.UIRect.X, listTop + float32(i)*(UIFieldHeight+UIFieldSpacing), n.UIRect.Width, UIFieldHeight}
+	}
+
+	for i := len(cols) - 1; i >= 0; i-- {
+		row := rowRect(i)
+		col := cols[i]
+		var entry *PickColumnsEntry
+		if i < len(p.Entries) {
+			entry = p.Entries[i]
+		}
+
+		if entry != nil {
+			// drag handle
+			handle := rl.Rectangle{row.X, row.Y, handleWidth, row.Height}
+			for k := float32(-1); k <= 1; k++ {
+				lineY := handle.Y + handle.Height/2 + k*5*zoomLevel
+				rl.DrawLineEx(rl.Vector2{handle.X + 4, lineY}, rl.Vector2{handle.X + handle.Width - 4, lineY}, 2, Brightness(n.Color, 0.45))
+			}
+			if raygui.GetState() != raygui.StateDisabled {
+				tryStartDrag(entry, handle, rl.Vector2{row.X, row.Y})
+			}
+		}
+
+		if p.Checklist {
+			picked := entry != nil
+			checked := raygui.CheckBox(rl.Rectangle{
+				row.X + handleWidth + UIFieldSpacing,
+				row.Y + (row.Height-checkboxSize)/2,
+				checkboxSize,
+				checkboxSize,
+			}, "", picked != p.Exclude)
+			if checked != (picked != p.Exclude) {
+				p.SetPicked(col, !picked)
+			}
+			drawBasicText(col, row.X+handleWidth+2*UIFieldSpacing+checkboxSize, row.Y+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+		} else {
+			func() {
+				if openDropdown == &entry.ColDropdown {
+					raygui.Enable()
+					defer raygui.Disable()
+				}
+
+				chosen := entry.ColDropdown.Do(rl.Rectangle{
+					row.X + handleWidth,
+					row.Y,
+					halfWidth - handleWidth,
+					UIFieldHeight,
+				})
+				entry.Col, _ = chosen.(string)
+			}()
+		}
+
+		if entry != nil {
+			aliasRect := rl.Rectangle{rightX, row.Y, halfWidth, UIFieldHeight}
 			entry.Alias, _ = entry.AliasTextbox.Do(aliasRect, entry.Alias, 100)
-		}()
+		}
 	}
+
+	// Entries are moved once they're dropped; until then, the row they'll
+	// end up on is outlined.
+	for i, entry := range p.Entries {
+		draggingThis, done, canceled := dragState(entry)
+		if !draggingThis {
+			continue
+		}
+
+		target := int((dragNewPosition().Y-listTop)/(UIFieldHeight+UIFieldSpacing) + 0.5)
+		if target < 0 {
+			target = 0
+		}
+		if target > len(p.Entries)-1 {
+			target = len(p.Entries) - 1
+		}
+
+		if !done {
+			rl.DrawRectangleLinesEx(rowRect(target), 2, Brightness(n.Color, 0.45))
+		} else if !canceled && target != i {
+			p.moveEntry(i, target)
+		}
+		break
+	}
+
+	// mode toggles
+	p.Checklist = raygui.Toggle(rl.Rectangle{n.UIRect.X, n.UIRect.Y, halfWidth, UIFieldHeight}, "Checklist", p.Checklist)
+	func() {
+		if !p.Checklist {
+			raygui.Disable()
+			defer raygui.Enable()
+		}
+		exclude := raygui.Toggle(rl.Rectangle{rightX, n.UIRect.Y, halfWidth, UIFieldHeight}, "Exclude", p.Exclude)
+		if exclude != p.Exclude {
+			// Keep the same columns picked; only what the ticks mean changes.
+			p.Exclude = exclude
+			p.Excluded = nil
+			if exclude {
+				for _, col := range schema {
+					if p.entry(col) == nil {
+						p.Excluded = append(p.Excluded, col)
+					}
+				}
+			}
+		}
+	}()
 }
 
 func (d *PickColumns) Serialize() (res string, active bool) {
+	res += fmt.Sprintf("%v%v", d.Checklist, d.Exclude)
 	for _, entry := range d.Entries {
 		res += entry.Col
 		res += entry.Alias
@@ -0,0 +1,324 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var PivotColor = rl.NewColor(214, 176, 120, 255)
+
+type Pivot struct {
+	RowCols   []*PivotRowCol
+	ColumnCol string          // spreads the values out across the table, if set
+	Value     AggregateColumn // only the type, column, and argument are used
+
+	ColumnColDropdown raygui.DropdownEx
+
+	Table  pivotTable
+	Status string
+
+	Size      rl.Vector2
+	StartSize rl.Vector2
+}
+
+type PivotRowCol struct {
+	Col         string
+	ColDropdown raygui.DropdownEx
+}
+
+var _ NodeData = &Pivot{}
+
+func NewPivot() *Node {
+	return &Node{
+		Title:   "Pivot",
+		CanSnap: true,
+		Color:   PivotColor,
+		Inputs:  make([]*Node, 1),
+		Data: &Pivot{
+			RowCols: []*PivotRowCol{{}},
+			Value:   AggregateColumn{Type: CountAll},
+			Size:    rl.Vector2{800, 600},
+		},
+	}
+}
+
+// The value and column rows, one row per row dimension, and the +/- buttons.
+func (d *Pivot) controlsHeight() float32 {
+	return float32(3+len(d.RowCols)) * (UIFieldHeight + UIFieldSpacing)
+}
+
+func (d *Pivot) Update(n *Node) {
+	if n.Schema == nil {
+		d.query(n)
+		n.Schema = getSchema(n)
+	}
+
+	opts := columnNameDropdownOpts(n.Inputs[0])
+	d.Value.TypeDropdown.SetOptions(aggregateTypeOpts...)
+	d.Value.TypeDropdown.SelectValue(d.Value.Type)
+	d.Value.ColDropdown.SetOptions(opts...)
+	d.Value.ColDropdown.SelectValue(d.Value.Col)
+	d.ColumnColDropdown.SetOptions(append([]raygui.DropdownExOption{{"No columns", ""}}, opts...)...)
+	d.ColumnColDropdown.SelectValue(d.ColumnCol)
+	for _, rc := range d.RowCols {
+		rc.ColDropdown.SetOptions(opts...)
+		rc.ColDropdown.SelectValue(rc.Col)
+	}
+
+	if minHeight := d.controlsHeight() + previewMinHeight; d.Size.Y < minHeight {
+		d.Size.Y = minHeight
+	}
+	n.UISize = d.Size
+}
+
+// query Aggregates the input at every level of the row dimensions at once,
+// since SQLite doesn't have GROUPING SETS. Each level is grouped both with and
+// without the column dimension, to get the totals on the right.
+func (d *Pivot) query(n *Node) {
+	d.Table.Data = nil
+	d.Status = ""
+	if n.Inputs[0] == nil || (d.Value.Type.HasCol() && d.Value.Col == "") {
+		return
+	}
+
+	var rowCols []string
+	for _, rc := range d.RowCols {
+		if rc.Col != "" {
+			rowCols = append(rowCols, rc.Col)
+		}
+	}
+
+	agg := GenAggregateEntry{
+		Type: d.Value.Type,
+		Col:  d.Value.Col,
+		Arg:  d.Value.ArgSql(),
+	}.Sql()
+
+	var selects []string
+	for level := 0; level <= len(rowCols); level++ {
+		dims := make([]string, len(rowCols))
+		for i := range dims {
+			dims[i] = "NULL"
+		}
+		copy(dims, rowCols[:level])
+
+		for _, colTotal := range []int{0, 1} {
+			if colTotal == 0 && d.ColumnCol == "" {
+				continue
+			}
+
+			groupBy := append([]string{}, rowCols[:level]...)
+			col := "NULL"
+			if colTotal == 0 {
+				col = d.ColumnCol
+				groupBy = append(groupBy, d.ColumnCol)
+			}
+
+			fields := append([]string{fmt.Sprint(level), fmt.Sprint(colTotal)}, dims...)
+			fields = append(fields, col, agg)
+			sel := fmt.Sprintf("SELECT %s FROM src", strings.Join(fields, ", "))
+			if len(groupBy) > 0 {
+				sel += " GROUP BY " + strings.Join(groupBy, ", ")
+			}
+			selects = append(selects, sel)
+		}
+	}
+
+	// Sorting by the row dimensions keeps each group's children in order,
+	// and the level puts the grand totals (where they're all NULL) first.
+	var orderBy []string
+	for i := range rowCols {
+		orderBy = append(orderBy, fmt.Sprint(3+i))
+	}
+	orderBy = append(orderBy, "1", fmt.Sprint(3+len(rowCols)))
+
+	res := doQuery(fmt.Sprintf(
+		"WITH src AS (\n%s\n)\n%s\nORDER BY %s",
+		n.Inputs[0].GenerateSql(false),
+		strings.Join(selects, "\nUNION ALL\n"),
+		strings.Join(orderBy, ", "),
+	))
+	if len(res.Columns) == 0 {
+		d.Status = "Couldn't run the query"
+		return
+	}
+
+	data := newPivotData(res, len(rowCols))
+	data.RowTitle = strings.Join(rowCols, " / ")
+	data.ValueTitle = agg
+	data.measure()
+	d.Table.Data = data
+
+	numGroups := 0
+	var countLeaves func(g *pivotGroup)
+	countLeaves = func(g *pivotGroup) {
+		if len(g.Children) == 0 {
+			numGroups++
+		}
+		for _, child := range g.Children {
+			countLeaves(child)
+		}
+	}
+	countLeaves(data.Root)
+	d.Status = fmt.Sprintf("%d groups", numGroups)
+	if numGroups == 1 {
+		d.Status = "1 group"
+	}
+	if data.Truncated {
+		d.Status += fmt.Sprintf(", first %d columns", pivotMaxCols)
+	}
+}
+
+func (d *Pivot) DoUI(n *Node) {
+	const labelWidth = 100 * zoomLevel
+	const typeWidth = 200 * zoomLevel
+	const argWidth = 70 * zoomLevel
+	const buttonWidth = 60 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldX := n.UIRect.X + labelWidth
+	fieldWidth := n.UIRect.Width - labelWidth
+	rowY := func(i int) float32 {
+		return n.UIRect.Y + float32(i)*(UIFieldHeight+UIFieldSpacing)
+	}
+	doDropdown := func(dropdown *raygui.DropdownEx, bounds rl.Rectangle) interface{} {
+		if openDropdown == dropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		return dropdown.Do(bounds)
+	}
+
+	// The table goes first so the dropdowns draw on top of it.
+	{
+		const padding = 20
+		tableRect := rl.Rectangle{
+			n.UIRect.X,
+			n.UIRect.Y + d.controlsHeight() + padding,
+			n.UIRect.Width,
+			n.UIRect.Height - d.controlsHeight() - padding,
+		}
+
+		LoadStyleMain()
+		d.Table.Draw(tableRect, !isOpen)
+		if rl.CheckCollisionPointRec(raygui.GetMousePositionWorld(), tableRect) {
+			didCaptureScrollThisFrame = true
+		}
+		LoadThemeForNode(n)
+	}
+
+	// +/- for row dimensions
+	{
+		y := rowY(2 + len(d.RowCols))
+		if raygui.Button(rl.Rectangle{fieldX, y, buttonWidth, UIFieldHeight}, "+") {
+			d.RowCols = append(d.RowCols, &PivotRowCol{})
+		}
+		if raygui.Button(rl.Rectangle{fieldX + buttonWidth + UIFieldSpacing, y, buttonWidth, UIFieldHeight}, "-") {
+			if len(d.RowCols) > 1 {
+				d.RowCols = d.RowCols[:len(d.RowCols)-1]
+			}
+		}
+		drawBasicText(d.Status, fieldX+2*(buttonWidth+UIFieldSpacing), y+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	}
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	for i := len(d.RowCols) - 1; i >= 0; i-- {
+		rc := d.RowCols[i]
+		y := rowY(2 + i)
+		label := "then"
+		if i == 0 {
+			label = "Rows"
+		}
+		drawBasicText(label, n.UIRect.X, y+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+		rc.Col, _ = doDropdown(&rc.ColDropdown, rl.Rectangle{fieldX, y, fieldWidth, UIFieldHeight}).(string)
+	}
+
+	drawBasicText("Columns", n.UIRect.X, rowY(1)+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	d.ColumnCol, _ = doDropdown(&d.ColumnColDropdown, rl.Rectangle{fieldX, rowY(1), fieldWidth, UIFieldHeight}).(string)
+
+	// value
+	{
+		y := rowY(0)
+		drawBasicText("Value", n.UIRect.X, y+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+
+		colWidth := fieldWidth - typeWidth - UIFieldSpacing
+		if d.Value.Type.HasArg() {
+			colWidth -= argWidth + UIFieldSpacing
+			d.Value.Arg, _ = d.Value.ArgTextbox.Do(rl.Rectangle{
+				n.UIRect.X + n.UIRect.Width - argWidth,
+				y,
+				argWidth,
+				UIFieldHeight,
+			}, d.Value.Arg, 10)
+		}
+		func() {
+			if !d.Value.Type.HasCol() {
+				raygui.Disable()
+				defer raygui.Enable()
+			}
+			d.Value.Col, _ = doDropdown(&d.Value.ColDropdown, rl.Rectangle{fieldX + typeWidth + UIFieldSpacing, y, colWidth, UIFieldHeight}).(string)
+		}()
+		d.Value.Type, _ = doDropdown(&d.Value.TypeDropdown, rl.Rectangle{fieldX, y, typeWidth, UIFieldHeight}).(AggregateType)
+	}
+
+	// dragging
+	{
+		bottomRight := rl.Vector2{n.Pos.X + n.Size.X, n.Pos.Y + n.Size.Y}
+		resizeRect := rl.Rectangle{bottomRight.X - 20, bottomRight.Y - 20, 20, 20}
+
+		drawResizeHandle(bottomRight, n.Color)
+
+		resizeDragKey := fmt.Sprintf("resize: %p", d)
+		if tryStartDrag(resizeDragKey, resizeRect, rl.Vector2{}) {
+			d.StartSize = d.Size
+		}
+
+		if resizingThis, _, canceled := dragState(resizeDragKey); resizingThis {
+			if canceled {
+				d.Size = d.StartSize
+			} else {
+				newSize := rl.Vector2Add(d.StartSize, dragOffset())
+				if newSize.X < previewMinWidth {
+					newSize.X = previewMinWidth
+				}
+				if minHeight := d.controlsHeight() + previewMinHeight; newSize.Y < minHeight {
+					newSize.Y = minHeight
+				}
+				d.Size = newSize
+			}
+		} else {
+			d.Size = rl.Vector2{n.UIRect.Width, n.UIRect.Height}
+		}
+	}
+}
+
+// Serialize Changes to any setting mean the table has to be queried again.
+// Collapsing groups doesn't.
+func (d *Pivot) Serialize() (res string, active bool) {
+	res += fmt.Sprintf("%d", d.Value.Type)
+	res += d.Value.Col
+	res += d.Value.Arg
+	res += d.ColumnCol
+	for _, rc := range d.RowCols {
+		res += "," + rc.Col
+	}
+	return res, d.Value.ArgTextbox.Active
+}
+
+func (d *Pivot) Dropdowns() []*raygui.DropdownEx {
+	res := []*raygui.DropdownEx{&d.Value.TypeDropdown, &d.Value.ColDropdown, &d.ColumnColDropdown}
+	for _, rc := range d.RowCols {
+		res = append(res, &rc.ColDropdown)
+	}
+	return res
+}
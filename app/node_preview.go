@@ -32,22 +32,94 @@ func NewPreview() *Node {
 	}
 }
 
+// One row per formatting rule, and one for the +/- buttons.
+func (d *Preview) controlsHeight() float32 {
+	return float32(len(d.Panel.Formats)+1) * (UIFieldHeight + UIFieldSpacing)
+}
+
 func (d *Preview) Update(n *Node) {
 	if n.Schema == nil {
 		d.Panel.Update(doQuery(n.GenerateSql(true)))
 		n.Schema = getSchema(n)
 	}
 
+	opts := columnNameDropdownOpts(n.Inputs[0])
+	for _, f := range d.Panel.Formats {
+		f.ColDropdown.SetOptions(opts...)
+		f.ColDropdown.SelectValue(f.Col)
+		f.KindDropdown.SetOptions(cellFormatKindOpts...)
+		f.KindDropdown.SelectValue(f.Kind)
+	}
+
+	if minHeight := d.controlsHeight() + previewMinHeight; d.Size.Y < minHeight {
+		d.Size.Y = minHeight
+	}
 	n.UISize = d.Size
 }
 
 func (d *Preview) DoUI(n *Node) {
-	LoadStyleMain()
+	const labelWidth = 100 * zoomLevel
+	const kindWidth = 220 * zoomLevel
+	const conditionWidth = 160 * zoomLevel
+	const buttonWidth = 60 * zoomLevel
+	const textSize = 20
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.Dropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
 
-	d.Panel.Draw(n.UIRect)
-	if rl.CheckCollisionPointRec(raygui.GetMousePositionWorld(), n.UIRect) {
+	gridRect := n.UIRect
+	gridRect.Y += d.controlsHeight()
+	gridRect.Height -= d.controlsHeight()
+
+	LoadStyleMain()
+	d.Panel.Draw(gridRect)
+	if rl.CheckCollisionPointRec(raygui.GetMousePositionWorld(), gridRect) {
 		didCaptureScrollThisFrame = true
 	}
+	LoadThemeForNode(n)
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	fieldY := gridRect.Y - UIFieldSpacing - UIFieldHeight
+	drawBasicText("Format", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	if raygui.Button(rl.Rectangle{n.UIRect.X + labelWidth, fieldY, buttonWidth, UIFieldHeight}, "+") {
+		d.Panel.Formats = append(d.Panel.Formats, &CellFormat{})
+	}
+	if raygui.Button(rl.Rectangle{n.UIRect.X + labelWidth + buttonWidth + UIFieldSpacing, fieldY, buttonWidth, UIFieldHeight}, "-") {
+		if len(d.Panel.Formats) > 0 {
+			d.Panel.Formats = d.Panel.Formats[:len(d.Panel.Formats)-1]
+		}
+	}
+
+	for i := len(d.Panel.Formats) - 1; i >= 0; i-- {
+		func() {
+			f := d.Panel.Formats[i]
+
+			if openDropdown == &f.ColDropdown || openDropdown == &f.KindDropdown {
+				raygui.Enable()
+				defer raygui.Disable()
+			}
+
+			fieldY -= UIFieldSpacing + UIFieldHeight
+			fieldX := n.UIRect.X + n.UIRect.Width
+
+			if f.Kind == Highlight {
+				fieldX -= conditionWidth
+				f.Condition, _ = f.ConditionTextbox.Do(rl.Rectangle{fieldX, fieldY, conditionWidth, UIFieldHeight}, f.Condition, 100)
+				fieldX -= UIFieldSpacing
+			}
+
+			fieldX -= kindWidth
+			kindRect := rl.Rectangle{fieldX, fieldY, kindWidth, UIFieldHeight}
+			fieldX -= UIFieldSpacing
+
+			f.Col, _ = f.ColDropdown.Do(rl.Rectangle{n.UIRect.X, fieldY, fieldX - n.UIRect.X, UIFieldHeight}).(string)
+			f.Kind, _ = f.KindDropdown.Do(kindRect).(CellFormatKind)
+		}()
+	}
 
 	bottomRight := rl.Vector2{n.Pos.X + n.Size.X, n.Pos.Y + n.Size.Y}
 	resizeRect := rl.Rectangle{bottomRight.X - 20, bottomRight.Y - 20, 20, 20}
@@ -67,8 +139,8 @@ func (d *Preview) DoUI(n *Node) {
 			if newSize.X < previewMinWidth {
 				newSize.X = previewMinWidth
 			}
-			if newSize.Y < previewMinHeight {
-				newSize.Y = previewMinHeight
+			if minHeight := d.controlsHeight() + previewMinHeight; newSize.Y < minHeight {
+				newSize.Y = minHeight
 			}
 			d.Size = newSize
 		}
@@ -77,6 +149,16 @@ func (d *Preview) DoUI(n *Node) {
 	}
 }
 
+// Serialize Formatting only changes how the results are drawn, so there's
+// nothing to query again.
 func (d *Preview) Serialize() (string, bool) {
 	return "", false
 }
+
+func (d *Preview) Dropdowns() []*raygui.DropdownEx {
+	res := make([]*raygui.DropdownEx, 0, 2*len(d.Panel.Formats))
+	for _, f := range d.Panel.Formats {
+		res = append(res, &f.ColDropdown, &f.KindDropdown)
+	}
+	return res
+}
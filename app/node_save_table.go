@@ -0,0 +1,210 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var SaveTableColor = rl.NewColor(220, 120, 100, 255)
+
+type SaveTable struct {
+	Name string
+	Mode SaveMode
+	Temp bool
+
+	NameTextbox  raygui.TextBoxEx
+	ModeDropdown raygui.DropdownEx
+
+	Confirming bool
+	Status     string
+}
+
+type SaveMode int
+
+const (
+	SaveCreate SaveMode = iota + 1
+	SaveReplace
+	SaveAppend
+)
+
+var _ NodeData = &SaveTable{}
+
+func NewSaveTable() *Node {
+	return &Node{
+		Title:   "Save Table",
+		CanSnap: true,
+		Color:   SaveTableColor,
+		Inputs:  make([]*Node, 1),
+		Data:    &SaveTable{},
+	}
+}
+
+var saveModeOpts = []raygui.DropdownExOption{
+	{"Create new table", SaveCreate},
+	{"Replace table", SaveReplace},
+	{"Append to table", SaveAppend},
+}
+
+func (d *SaveTable) Update(n *Node) {
+	n.UISize = rl.Vector2{440, 4*UIFieldHeight + 3*UIFieldSpacing}
+	d.ModeDropdown.SetOptions(saveModeOpts...)
+}
+
+func (d *SaveTable) DoUI(n *Node) {
+	const tempWidth = 100 * zoomLevel
+	const textSize = 20
+
+	dropdownOpen := d.ModeDropdown.Open
+	if dropdownOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldY := n.UIRect.Y
+
+	d.Name, _ = d.NameTextbox.Do(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width - tempWidth - UIFieldSpacing,
+		UIFieldHeight,
+	}, d.Name, 100)
+	d.Temp = raygui.Toggle(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width - tempWidth,
+		fieldY,
+		tempWidth,
+		UIFieldHeight,
+	}, "Temp", d.Temp)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	// The dropdown is drawn last so its list ends up on top.
+	modeY := fieldY
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	drawBasicText(d.Status, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	if d.Confirming {
+		if raygui.Button(rl.Rectangle{
+			n.UIRect.X,
+			fieldY,
+			n.UIRect.Width/2 - UIFieldSpacing/2,
+			UIFieldHeight,
+		}, "Confirm") {
+			d.Confirming = false
+			count, err := saveTable(n.GenerateSql(false), d.Name, d.Mode, d.Temp)
+			if err != nil {
+				d.Status = err.Error()
+			} else {
+				d.Status = fmt.Sprintf("Saved %d rows to %s.", count, d.Name)
+				refreshTableDropdowns()
+				clearAllSchemas()
+			}
+		}
+		if raygui.Button(rl.Rectangle{
+			n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+			fieldY,
+			n.UIRect.Width/2 - UIFieldSpacing/2,
+			UIFieldHeight,
+		}, "Cancel") {
+			d.Confirming = false
+			d.Status = ""
+		}
+	} else if raygui.Button(rl.Rectangle{n.UIRect.X, fieldY, n.UIRect.Width, UIFieldHeight}, "Save") {
+		if err := validateTableName(d.Name); err != nil {
+			d.Status = err.Error()
+		} else if n.Inputs[0] == nil {
+			d.Status = "Nothing to save."
+		} else {
+			d.Confirming = true
+			switch d.Mode {
+			case SaveReplace:
+				d.Status = fmt.Sprintf("Replace all of %s?", d.Name)
+			case SaveAppend:
+				d.Status = fmt.Sprintf("Add rows to %s?", d.Name)
+			default:
+				d.Status = fmt.Sprintf("Create %s?", d.Name)
+			}
+		}
+	}
+
+	func() {
+		if dropdownOpen {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		mode := d.ModeDropdown.Do(rl.Rectangle{n.UIRect.X, modeY, n.UIRect.Width, UIFieldHeight})
+		d.Mode, _ = mode.(SaveMode)
+	}()
+}
+
+func (d *SaveTable) Serialize() (string, bool) {
+	return "", false
+}
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func validateTableName(name string) error {
+	if name == "" {
+		return errors.New("Enter a table name.")
+	}
+	if !tableNameRegexp.MatchString(name) {
+		return errors.New("Use only letters, numbers, and _.")
+	}
+	if isSQLiteKeyword(name) {
+		return errors.New("That's an SQL keyword. Try adding a _.")
+	}
+	return nil
+}
+
+// Writes the results of a query into a table, all in one transaction.
+// Returns the number of rows written.
+func saveTable(query string, name string, mode SaveMode, temp bool) (int64, error) {
+	if err := validateTableName(name); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // does nothing if we committed
+
+	create := "CREATE TABLE"
+	qualifiedName := name
+	if temp {
+		create = "CREATE TEMP TABLE"
+		qualifiedName = "temp." + name
+	}
+
+	var count int64
+	switch mode {
+	case SaveAppend:
+		res, err := tx.Exec(fmt.Sprintf("INSERT INTO %s %s", name, query))
+		if err != nil {
+			return 0, err
+		}
+		count, err = res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	default:
+		if mode == SaveReplace {
+			if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", qualifiedName)); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf("%s %s AS %s", create, name, query)); err != nil {
+			return 0, err
+		}
+		err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", qualifiedName)).Scan(&count)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return count, tx.Commit()
+}
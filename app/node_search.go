@@ -0,0 +1,298 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var SearchColor = rl.NewColor(110, 200, 180, 255)
+
+// The FTS5 ranking column. Lower is a better match.
+const searchRankCol = "rank"
+
+type Search struct {
+	Col      string
+	Query    string
+	Advanced bool // pass the query straight to FTS5 instead of matching plain words
+
+	ColDropdown  raygui.DropdownEx
+	QueryTextbox raygui.TextBoxEx
+
+	Status    string
+	indexName string
+	rebuilds  int
+}
+
+func NewSearch() *Node {
+	return &Node{
+		Title:   "Search",
+		CanSnap: true,
+		Color:   SearchColor,
+		Inputs:  make([]*Node, 1),
+		Data:    &Search{},
+	}
+}
+
+// MatchQuery Gets the FTS5 query to run. In plain mode every word has to
+// appear, and a trailing * still works for prefix searches.
+func (d *Search) MatchQuery() string {
+	if d.Advanced {
+		return strings.TrimSpace(d.Query)
+	}
+
+	var terms []string
+	for _, word := range strings.Fields(d.Query) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimSuffix(word, "*")
+		if word == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+func (d *Search) Update(n *Node) {
+	if n.Schema == nil {
+		d.updateIndex(n)
+		n.Schema = getSchema(n)
+	}
+
+	n.UISize = rl.Vector2{440, 4*UIFieldHeight + 3*UIFieldSpacing}
+	d.ColDropdown.SetOptions(columnNameDropdownOpts(n.Inputs[0])...)
+}
+
+// Switches to the index for the current input, building it if needed. This
+// runs whenever the graph changes, since the input's SQL might have.
+func (d *Search) updateIndex(n *Node) {
+	name, inputSql := "", ""
+	if n.Inputs[0] != nil && d.Col != "" {
+		inputSql = NewQueryContextFromNode(n.Inputs[0]).SourceToSql(0)
+		name = searchIndexName(inputSql, d.Col)
+	}
+	if name != d.indexName {
+		releaseSearchIndex(d.indexName)
+		retainSearchIndex(name)
+		d.indexName = name
+	}
+	if name == "" {
+		d.Status = ""
+		return
+	}
+
+	count, built, err := ensureSearchIndex(name, inputSql, d.Col, getSchema(n.Inputs[0]))
+	if err != nil {
+		d.Status = err.Error()
+		return
+	}
+	d.Status = fmt.Sprintf("Searching %d rows.", count)
+	if built {
+		// Anything downstream that got its SQL before the index existed
+		// has to get it again.
+		clearAllSchemas()
+	}
+}
+
+func (d *Search) DoUI(n *Node) {
+	const labelWidth = 100 * zoomLevel
+	const textSize = 20
+
+	dropdownOpen := d.ColDropdown.Open
+	if dropdownOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	fieldX := n.UIRect.X + labelWidth
+	fieldWidth := n.UIRect.Width - labelWidth
+
+	// The column dropdown is drawn last so its list ends up on top.
+	fieldY := n.UIRect.Y + UIFieldHeight + UIFieldSpacing
+	drawBasicText("Find", n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+	d.Query, _ = d.QueryTextbox.Do(rl.Rectangle{fieldX, fieldY, fieldWidth, UIFieldHeight}, d.Query, 100)
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	d.Advanced = raygui.Toggle(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "FTS5 syntax", d.Advanced)
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "Rebuild index") {
+		// The index is a snapshot, so it has to be rebuilt by hand when the
+		// underlying tables change.
+		forgetSearchIndex(d.indexName)
+		d.rebuilds++
+	}
+	fieldY += UIFieldHeight + UIFieldSpacing
+
+	drawBasicText(d.Status, n.UIRect.X, fieldY+(UIFieldHeight-textSize)/2, textSize, rl.Black)
+
+	func() {
+		if dropdownOpen {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+		col := d.ColDropdown.Do(rl.Rectangle{fieldX, n.UIRect.Y, fieldWidth, UIFieldHeight})
+		d.Col, _ = col.(string)
+	}()
+}
+
+func (d *Search) Serialize() (res string, active bool) {
+	res += d.Col
+	res += d.Query
+	res += fmt.Sprintf("%v%d", d.Advanced, d.rebuilds)
+	return res, d.QueryTextbox.Active
+}
+
+// Close Lets go of this node's search index, so it gets dropped once no
+// other Search node is using it.
+func (d *Search) Close() {
+	releaseSearchIndex(d.indexName)
+	d.indexName = ""
+}
+
+/*
+Search indexes are temporary FTS5 tables holding a copy of the input rows.
+Only the searched column is indexed; the rest come along UNINDEXED so results
+can be read straight out of the index. Each index is named after a hash of the
+input query, so an index is reused until the input changes.
+*/
+
+type searchIndex struct {
+	refs  int // the Search nodes using it; two nodes can search the same input
+	built bool
+	count int64 // the number of rows it holds
+}
+
+// The search indexes in use this session, by name.
+var searchIndexes = map[string]*searchIndex{}
+
+func searchIndexName(inputSql string, col string) string {
+	h := fnv.New32a()
+	h.Write([]byte(inputSql))
+	h.Write([]byte{0})
+	h.Write([]byte(col))
+	return fmt.Sprintf("sqljam_search_%08x", h.Sum32())
+}
+
+// Whether an index is ready to be searched. SQL generation checks this
+// instead of building the index itself.
+func searchIndexBuilt(name string) bool {
+	index, ok := searchIndexes[name]
+	return ok && index.built
+}
+
+func retainSearchIndex(name string) {
+	if name == "" {
+		return
+	}
+	if searchIndexes[name] == nil {
+		searchIndexes[name] = &searchIndex{}
+	}
+	searchIndexes[name].refs++
+}
+
+// Lets go of an index, dropping it once no Search node is using it.
+func releaseSearchIndex(name string) {
+	index, ok := searchIndexes[name]
+	if !ok {
+		return
+	}
+	index.refs--
+	if index.refs > 0 {
+		return
+	}
+
+	delete(searchIndexes, name)
+	if _, err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS temp.%s", name)); err != nil {
+		log.Print(err)
+	}
+}
+
+// Builds a search index over the results of a query, unless it's already
+// built. Returns how many rows it holds and whether it was built just now.
+func ensureSearchIndex(name string, inputSql string, col string, schema []string) (int64, bool, error) {
+	index := searchIndexes[name]
+	if index.built {
+		return index.count, false, nil
+	}
+
+	found := false
+	colDefs := make([]string, len(schema))
+	for i, schemaCol := range schema {
+		if strings.EqualFold(schemaCol, searchRankCol) || strings.EqualFold(schemaCol, name) {
+			return 0, false, fmt.Errorf("Rename the %s column to search this table.", schemaCol)
+		}
+		colDefs[i] = schemaCol
+		if schemaCol == col {
+			found = true
+		} else {
+			colDefs[i] += " UNINDEXED"
+		}
+	}
+	if !found {
+		return 0, false, fmt.Errorf("There is no %s column.", col)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback() // does nothing if we committed
+
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS temp.%s", name)); err != nil {
+		return 0, false, err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"CREATE VIRTUAL TABLE temp.%s USING fts5(%s, tokenize = 'porter unicode61')",
+		name, strings.Join(colDefs, ", "),
+	))
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return 0, false, errors.New("SQLite was built without FTS5.")
+		}
+		return 0, false, err
+	}
+	res, err := tx.Exec(fmt.Sprintf(
+		"INSERT INTO temp.%s (%s) SELECT %s FROM (%s)",
+		name, strings.Join(schema, ", "), strings.Join(schema, ", "), inputSql,
+	))
+	if err != nil {
+		return 0, false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+
+	index.built = true
+	index.count = count
+	return count, true, nil
+}
+
+// Marks an index as out of date. It will be rebuilt the next time the graph
+// changes.
+func forgetSearchIndex(name string) {
+	if index, ok := searchIndexes[name]; ok {
+		index.built = false
+	}
+}
@@ -44,6 +44,7 @@ func (t *Table) Update(n *Node) {
 	// init dropdown
 	if len(t.TableDropdown.GetOptions()) == 0 {
 		updateTableDropdown(&t.TableDropdown)
+		t.TableDropdown.SelectValue(t.Table)
 	}
 
 	n.UISize = rl.Vector2{X: 240, Y: UIFieldHeight}
@@ -55,10 +56,25 @@ func (t *Table) DoUI(n *Node) {
 	}
 }
 
+// Reloads the table list of every Table node, e.g. after a table has been
+// created. Each node keeps the table it had selected.
+func refreshTableDropdowns() {
+	for _, n := range nodes {
+		if t, ok := n.Data.(*Table); ok {
+			updateTableDropdown(&t.TableDropdown)
+			t.TableDropdown.SelectValue(t.Table)
+		}
+	}
+}
+
 func updateTableDropdown(dropdown *raygui.DropdownEx) {
 	rows, err := db.Query(`
 		SELECT name
-		FROM sqlite_master
+		FROM (
+			SELECT name, type FROM sqlite_master
+			UNION ALL
+			SELECT name, type FROM sqlite_temp_master
+		)
 		WHERE
 			type = 'table'
 			AND name NOT LIKE 'sqlite_%'
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var TopNColor = rl.NewColor(236, 140, 180, 255)
+
+// The name of the ROW_NUMBER() column used to pick rows. It never shows up in
+// the node's output.
+const topNRankCol = "sqljam_rank"
+
+type TopN struct {
+	Count      string
+	OrderCol   string
+	Descending bool
+	GroupBys   []*TopNGroupBy
+
+	CountTextbox     raygui.TextBoxEx
+	OrderColDropdown raygui.DropdownEx
+}
+
+type TopNGroupBy struct {
+	Col         string
+	ColDropdown raygui.DropdownEx
+}
+
+func NewTopN() *Node {
+	return &Node{
+		Title:   "Top N",
+		CanSnap: true,
+		Color:   TopNColor,
+		Inputs:  make([]*Node, 1),
+		Data: &TopN{
+			Count:      "3",
+			Descending: true,
+			GroupBys:   []*TopNGroupBy{{}},
+		},
+	}
+}
+
+// N Gets the number of rows to keep per group. Anything that isn't a
+// positive number is treated as 1.
+func (d *TopN) N() int {
+	count, err := strconv.Atoi(strings.TrimSpace(d.Count))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+// RankExpression Gets the window function used to number the rows in each
+// group.
+func (d *TopN) RankExpression() string {
+	var partitionCols []string
+	for _, gb := range d.GroupBys {
+		if gb.Col != "" {
+			partitionCols = append(partitionCols, gb.Col)
+		}
+	}
+
+	partition := ""
+	if len(partitionCols) > 0 {
+		partition = fmt.Sprintf("PARTITION BY %s ", strings.Join(partitionCols, ", "))
+	}
+
+	direction := ""
+	if d.Descending {
+		direction = " DESC"
+	}
+
+	return fmt.Sprintf("ROW_NUMBER() OVER (%sORDER BY %s%s)", partition, d.OrderCol, direction)
+}
+
+func (d *TopN) AllDropdowns() []*raygui.DropdownEx {
+	res := make([]*raygui.DropdownEx, 0, 1+len(d.GroupBys))
+	res = append(res, &d.OrderColDropdown)
+	for _, gb := range d.GroupBys {
+		res = append(res, &gb.ColDropdown)
+	}
+	return res
+}
+
+func (d *TopN) Update(n *Node) {
+	height := 0
+	height += UIFieldHeight + UIFieldSpacing // count, order by
+	height += UIFieldHeight + UIFieldSpacing // "Per group" label
+	for range d.GroupBys {
+		height += UIFieldHeight + UIFieldSpacing
+	}
+	height += UIFieldHeight // for +/- buttons
+
+	n.UISize = rl.Vector2{440, float32(height)}
+
+	colOpts := columnNameDropdownOpts(n.Inputs[0])
+	d.OrderColDropdown.SetOptions(colOpts...)
+	for _, gb := range d.GroupBys {
+		gb.ColDropdown.SetOptions(colOpts...)
+	}
+}
+
+func (d *TopN) DoUI(n *Node) {
+	const countWidth = 80 * zoomLevel
+	const directionWidth = 80 * zoomLevel
+
+	openDropdown, isOpen := raygui.GetOpenDropdown(d.AllDropdowns())
+	if isOpen {
+		raygui.Disable()
+		defer raygui.Enable()
+	}
+
+	// Render bottom to top to avoid overlap issues with dropdowns
+
+	fieldY := n.UIRect.Y + n.UIRect.Height - UIFieldHeight
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "+") {
+		d.GroupBys = append(d.GroupBys, &TopNGroupBy{})
+	}
+	if raygui.Button(rl.Rectangle{
+		n.UIRect.X + n.UIRect.Width/2 + UIFieldSpacing/2,
+		fieldY,
+		n.UIRect.Width/2 - UIFieldSpacing/2,
+		UIFieldHeight,
+	}, "-") {
+		if len(d.GroupBys) > 0 {
+			d.GroupBys = d.GroupBys[:len(d.GroupBys)-1]
+		}
+	}
+
+	for i := len(d.GroupBys) - 1; i >= 0; i-- {
+		func() {
+			gb := d.GroupBys[i]
+
+			if openDropdown == &gb.ColDropdown {
+				raygui.Enable()
+				defer raygui.Disable()
+			}
+
+			fieldY -= UIFieldSpacing + UIFieldHeight
+			icol := gb.ColDropdown.Do(rl.Rectangle{n.UIRect.X, fieldY, n.UIRect.Width, UIFieldHeight})
+			gb.Col, _ = icol.(string)
+		}()
+	}
+
+	fieldY -= UIFieldSpacing + UIFieldHeight
+	const textSize = 20
+	drawBasicText("Per group of", n.UIRect.X, fieldY+(UIFieldHeight-textSize), textSize, rl.Black)
+
+	fieldY -= UIFieldSpacing + UIFieldHeight
+	func() {
+		if openDropdown == &d.OrderColDropdown {
+			raygui.Enable()
+			defer raygui.Disable()
+		}
+
+		fieldX := n.UIRect.X
+		d.Count, _ = d.CountTextbox.Do(rl.Rectangle{fieldX, fieldY, countWidth, UIFieldHeight}, d.Count, 10)
+		fieldX += countWidth + UIFieldSpacing
+
+		orderCol := d.OrderColDropdown.Do(rl.Rectangle{
+			fieldX,
+			fieldY,
+			n.UIRect.X + n.UIRect.Width - fieldX - directionWidth - UIFieldSpacing,
+			UIFieldHeight,
+		})
+		d.OrderCol, _ = orderCol.(string)
+
+		directionStr := "Low"
+		if d.Descending {
+			directionStr = "High"
+		}
+		d.Descending = raygui.Toggle(rl.Rectangle{
+			n.UIRect.X + n.UIRect.Width - directionWidth,
+			fieldY,
+			directionWidth,
+			UIFieldHeight,
+		}, directionStr, d.Descending)
+	}()
+}
+
+func (d *TopN) Serialize() (res string, active bool) {
+	res += d.Count
+	res += d.OrderCol
+	res += fmt.Sprintf("%v", d.Descending)
+	for _, gb := range d.GroupBys {
+		res += gb.Col
+	}
+	return res, d.CountTextbox.Active
+}
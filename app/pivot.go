@@ -0,0 +1,327 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bvisness/SQLJam/raygui"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Past this many values of the column dimension, the rest are left out of the
+// table. They still count toward the totals.
+const pivotMaxCols = 50
+
+const pivotIndent = 24 * zoomLevel
+const pivotTriangleSize = 10 * zoomLevel
+
+// pivotGroup One row of a pivot table: the rows sharing a value of a row
+// dimension, with the aggregate for each value of the column dimension and
+// for all of them together. Groups with children show subtotals.
+type pivotGroup struct {
+	Label    string
+	Path     string // this group's label and its parents', for remembering which are collapsed
+	Depth    int    // 0 for the grand total
+	Cells    map[int]interface{}
+	Total    interface{}
+	Children []*pivotGroup
+
+	childIndexes map[string]int
+}
+
+func (g *pivotGroup) child(label string) *pivotGroup {
+	if i, ok := g.childIndexes[label]; ok {
+		return g.Children[i]
+	}
+	if g.childIndexes == nil {
+		g.childIndexes = make(map[string]int)
+	}
+
+	child := &pivotGroup{
+		Label: label,
+		Path:  g.Path + "\x00" + label,
+		Depth: g.Depth + 1,
+		Cells: make(map[int]interface{}),
+	}
+	g.childIndexes[label] = len(g.Children)
+	g.Children = append(g.Children, child)
+	return child
+}
+
+type pivotData struct {
+	RowTitle   string   // the row dimensions, for the top left corner
+	ValueTitle string   // the aggregate, for the totals column when there's no column dimension
+	Cols       []string // the values of the column dimension, in order
+	Truncated  bool     // whether there were more than pivotMaxCols of them
+	Root       *pivotGroup
+
+	LabelWidth float32
+	ColWidths  []float32
+	TotalWidth float32
+}
+
+// newPivotData Builds the tree of groups from the results of a pivot query.
+// Each row of the results is one cell: its level (the number of row
+// dimensions it's grouped by), whether it's a total across all the columns,
+// the values of the row dimensions, the value of the column dimension, and
+// finally the aggregate.
+func newPivotData(res *queryResult, numRowCols int) *pivotData {
+	data := &pivotData{
+		Root: &pivotGroup{Cells: make(map[int]interface{})},
+	}
+	colIndexes := make(map[string]int)
+
+	for _, row := range res.Rows {
+		level, _ := sqlNumber(row[0])
+		colTotal, _ := sqlNumber(row[1])
+		dims := row[2 : 2+numRowCols]
+		col, value := row[2+numRowCols], row[3+numRowCols]
+
+		group := data.Root
+		for _, dim := range dims[:int(level)] {
+			group = group.child(pivotLabel(dim))
+		}
+
+		if colTotal != 0 {
+			group.Total = value
+			continue
+		}
+
+		label := pivotLabel(col)
+		ci, ok := colIndexes[label]
+		if !ok {
+			if len(data.Cols) >= pivotMaxCols {
+				data.Truncated = true
+				continue
+			}
+			ci = len(data.Cols)
+			colIndexes[label] = ci
+			data.Cols = append(data.Cols, label)
+		}
+		group.Cells[ci] = value
+	}
+
+	return data
+}
+
+func pivotLabel(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	return chartLabel(v)
+}
+
+// Formats an aggregate, leaving off the float noise that comes from adding
+// things up. Cells with no rows at all are blank.
+func pivotCellText(v interface{}, ok bool) string {
+	if !ok {
+		return ""
+	}
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case float64:
+		rounded, _ := strconv.ParseFloat(strconv.FormatFloat(val, 'g', 10, 64), 64)
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func (d *pivotData) totalTitle() string {
+	if len(d.Cols) == 0 {
+		return d.ValueTitle
+	}
+	return "Total"
+}
+
+// measure Works out the column widths once, from every group whether it's
+// showing or not, so they don't jump around as groups are collapsed.
+func (d *pivotData) measure() {
+	cellWidth := func(text string) float32 {
+		return resultCellPaddingH + measureBasicText(text, resultFontSize).X + resultCellPaddingH
+	}
+
+	d.LabelWidth = cellWidth(d.RowTitle)
+	d.ColWidths = make([]float32, len(d.Cols))
+	for i, col := range d.Cols {
+		d.ColWidths[i] = cellWidth(col)
+	}
+	d.TotalWidth = cellWidth(d.totalTitle())
+
+	var measureGroup func(g *pivotGroup)
+	measureGroup = func(g *pivotGroup) {
+		labelWidth := cellWidth(g.Label) + float32(g.Depth-1)*pivotIndent + pivotTriangleSize + resultCellPaddingH
+		if g.Depth == 0 {
+			labelWidth = cellWidth("Total")
+		}
+		if d.LabelWidth < labelWidth {
+			d.LabelWidth = labelWidth
+		}
+		for i, v := range g.Cells {
+			if w := cellWidth(pivotCellText(v, true)); d.ColWidths[i] < w {
+				d.ColWidths[i] = w
+			}
+		}
+		if w := cellWidth(pivotCellText(g.Total, true)); d.TotalWidth < w {
+			d.TotalWidth = w
+		}
+		for _, child := range g.Children {
+			measureGroup(child)
+		}
+	}
+	measureGroup(d.Root)
+}
+
+// visibleRows Lists the groups to show, each followed by its children unless
+// it's collapsed, with the grand total at the bottom.
+func (d *pivotData) visibleRows(collapsed map[string]bool) []*pivotGroup {
+	var rows []*pivotGroup
+	var addGroup func(g *pivotGroup)
+	addGroup = func(g *pivotGroup) {
+		rows = append(rows, g)
+		if collapsed[g.Path] {
+			return
+		}
+		for _, child := range g.Children {
+			addGroup(child)
+		}
+	}
+	for _, child := range d.Root.Children {
+		addGroup(child)
+	}
+	return append(rows, d.Root)
+}
+
+// pivotTable Shows pivot data like the results grid, with a triangle on each
+// group that can be clicked to collapse or expand it.
+type pivotTable struct {
+	Data        *pivotData
+	Collapsed   map[string]bool // by group path
+	ScrollPanel raygui.ScrollPanelEx
+}
+
+func (t *pivotTable) toggle(g *pivotGroup) {
+	if t.Collapsed == nil {
+		t.Collapsed = make(map[string]bool)
+	}
+	t.Collapsed[g.Path] = !t.Collapsed[g.Path]
+}
+
+func (t *pivotTable) Draw(bounds rl.Rectangle, interactive bool) {
+	if t.Data == nil {
+		return
+	}
+	data := t.Data
+
+	widths := append([]float32{data.LabelWidth}, data.ColWidths...)
+	widths = append(widths, data.TotalWidth)
+	var totalWidth float32
+	for _, w := range widths {
+		totalWidth += w
+	}
+
+	rows := data.visibleRows(t.Collapsed)
+	mouse := raygui.GetMousePositionWorld()
+
+	panelContents := rl.Rectangle{0, 0, totalWidth, float32((len(rows) + 1) * resultRowHeight)}
+	t.ScrollPanel.Do(bounds, panelContents, func(scroll raygui.ScrollContext) {
+		cellPos := scroll.Start
+		textY := func() float32 {
+			return cellPos.Y + resultCellPaddingV + 1
+		}
+		drawRightAligned := func(text string, width float32) {
+			x := cellPos.X + width - resultCellPaddingH - measureBasicText(text, resultFontSize).X
+			drawBasicText(text, x, textY(), resultFontSize, PaneFontColor)
+		}
+		drawRowLine := func() {
+			lineY := cellPos.Y + resultRowHeight
+			if scroll.View.Y <= lineY && lineY <= scroll.View.Y+scroll.View.Height {
+				rl.DrawLine(int32(scroll.View.X), int32(lineY), int32(scroll.View.X+scroll.View.Width), int32(lineY), PaneLineColor)
+			}
+		}
+
+		// headers
+		drawBasicText(data.RowTitle, cellPos.X+resultCellPaddingH, textY(), resultFontSize, PaneFontColor)
+		cellPos.X += data.LabelWidth
+		for i, col := range data.Cols {
+			drawRightAligned(col, data.ColWidths[i])
+			cellPos.X += data.ColWidths[i]
+		}
+		drawRightAligned(data.totalTitle(), data.TotalWidth)
+		drawRowLine()
+		cellPos.Y += resultRowHeight
+
+		for _, g := range rows {
+			rowRect := rl.Rectangle{scroll.Start.X, cellPos.Y, totalWidth, resultRowHeight}
+			if !rl.CheckCollisionRecs(rowRect, scroll.View) {
+				cellPos.Y += resultRowHeight
+				continue
+			}
+
+			// Subtotals and the grand total are shaded.
+			if len(g.Children) > 0 {
+				rl.DrawRectangleRec(rowRect, rl.ColorAlpha(PaneLineColor, 0.3))
+			}
+
+			cellPos.X = scroll.Start.X
+			if g.Depth == 0 {
+				drawBasicText("Total", cellPos.X+resultCellPaddingH, textY(), resultFontSize, PaneFontColor)
+			} else {
+				x := cellPos.X + resultCellPaddingH + float32(g.Depth-1)*pivotIndent
+				if len(g.Children) > 0 {
+					drawPivotTriangle(rl.Vector2{x, cellPos.Y + resultRowHeight/2}, t.Collapsed[g.Path])
+
+					labelCell := rl.Rectangle{cellPos.X, cellPos.Y, data.LabelWidth, resultRowHeight}
+					if interactive &&
+						rl.IsMouseButtonPressed(rl.MouseLeftButton) &&
+						rl.CheckCollisionPointRec(mouse, labelCell) &&
+						rl.CheckCollisionPointRec(mouse, scroll.View) {
+						t.toggle(g)
+					}
+				}
+				drawBasicText(g.Label, x+pivotTriangleSize+resultCellPaddingH, textY(), resultFontSize, PaneFontColor)
+			}
+			cellPos.X += data.LabelWidth
+
+			for i := range data.Cols {
+				v, ok := g.Cells[i]
+				drawRightAligned(pivotCellText(v, ok), data.ColWidths[i])
+				cellPos.X += data.ColWidths[i]
+			}
+			drawRightAligned(pivotCellText(g.Total, true), data.TotalWidth)
+
+			drawRowLine()
+			cellPos.Y += resultRowHeight
+		}
+
+		gridX := scroll.Start.X
+		for _, width := range widths {
+			gridX += width
+			rl.DrawLine(int32(gridX), int32(scroll.View.Y), int32(gridX), int32(scroll.View.Y+scroll.View.Height), PaneLineColor)
+		}
+	})
+}
+
+// Draws a triangle pointing right for a collapsed group, or down for an
+// expanded one, with its left edge at pos.
+func drawPivotTriangle(pos rl.Vector2, collapsed bool) {
+	const s = pivotTriangleSize
+	if collapsed {
+		rl.DrawTriangle(
+			rl.Vector2{pos.X, pos.Y - s/2},
+			rl.Vector2{pos.X, pos.Y + s/2},
+			rl.Vector2{pos.X + s, pos.Y},
+			PaneFontColor,
+		)
+	} else {
+		rl.DrawTriangle(
+			rl.Vector2{pos.X, pos.Y - s/3},
+			rl.Vector2{pos.X + s/2, pos.Y + s/2},
+			rl.Vector2{pos.X + s, pos.Y - s/3},
+			PaneFontColor,
+		)
+	}
+}
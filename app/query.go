@@ -2,13 +2,18 @@ package app
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// The UI's connection. It's limited to one, since TEMP tables only exist on
+// the connection that created them and every node has to see them.
 var db *sql.DB
 
+// Background jobs get their own connections, so long imports and counts
+// don't leave the UI waiting on its only connection.
+var bgDB *sql.DB
+
 // TODO: Surely this is pretty temporary. I just need to display boring query output.
 type queryResult struct {
 	Columns []string
@@ -17,12 +22,19 @@ type queryResult struct {
 
 func openDB() func() {
 	var err error
-	db, err = sql.Open("sqlite3", "./sakila.db")
+	db, err = sql.Open(sqliteDriverName, "./sakila.db")
+	if err != nil {
+		panic(err)
+	}
+	db.SetMaxOpenConns(1)
+
+	bgDB, err = sql.Open(sqliteDriverName, "./sakila.db")
 	if err != nil {
 		panic(err)
 	}
 
 	return func() {
+		bgDB.Close()
 		db.Close()
 	}
 }
@@ -56,10 +68,35 @@ func doQuery(q string) *queryResult {
 		res.Rows = append(res.Rows, row)
 	}
 
+	// Some errors, like bad FTS5 queries, only show up while stepping
+	// through the rows.
 	err = rows.Err()
 	if err != nil {
-		panic(err)
+		log.Print(err)
+		return &queryResult{}
 	}
 
 	return &res
 }
+
+var sqliteVersion [3]int
+
+// Checks whether the SQLite we're running is at least the given version.
+func sqliteVersionAtLeast(major, minor, patch int) bool {
+	if sqliteVersion[0] == 0 {
+		var version string
+		if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+			log.Print(err)
+			return false
+		}
+		fmt.Sscanf(version, "%d.%d.%d", &sqliteVersion[0], &sqliteVersion[1], &sqliteVersion[2])
+	}
+
+	want := [3]int{major, minor, patch}
+	for i := range want {
+		if sqliteVersion[i] != want[i] {
+			return sqliteVersion[i] > want[i]
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -20,6 +21,9 @@ type QueryResultPanel struct {
 
 	Rows      [][]string
 	ColWidths []float32
+	ColRanges []cellRange
+
+	Formats []*CellFormat // conditional formatting, for the grids in Preview nodes
 }
 
 func (p *QueryResultPanel) Update(q *queryResult) {
@@ -35,12 +39,29 @@ func (p *QueryResultPanel) Update(q *queryResult) {
 			row := p.QueryResult.Rows[i]
 			valStrings := make([]string, len(row))
 			for i, v := range row {
-				valStrings[i] = fmt.Sprintf("%v", v)
+				valStrings[i] = cellText(v)
 			}
 			p.Rows = append(p.Rows, valStrings)
 		}
 	}
 
+	p.ColRanges = make([]cellRange, len(p.QueryResult.Columns))
+	for c := range p.ColRanges {
+		p.ColRanges[c] = cellRange{math.NaN(), math.NaN()}
+		for _, row := range p.QueryResult.Rows {
+			num, ok := cellNumber(row[c])
+			if !ok {
+				continue
+			}
+			if math.IsNaN(p.ColRanges[c].Min) || num < p.ColRanges[c].Min {
+				p.ColRanges[c].Min = num
+			}
+			if math.IsNaN(p.ColRanges[c].Max) || num > p.ColRanges[c].Max {
+				p.ColRanges[c].Max = num
+			}
+		}
+	}
+
 	p.ColWidths = make([]float32, len(p.Rows[0]))
 	for r := 0; r < len(p.Rows); r++ {
 		for c := 0; c < len(p.Rows[0]); c++ {
@@ -65,12 +86,22 @@ func (p *QueryResultPanel) Draw(bounds rl.Rectangle) {
 	panelContents := rl.Rectangle{0, 0, totalWidth, float32(len(p.Rows) * resultRowHeight)}
 	p.ScrollPanel.Do(bounds, panelContents, func(scroll raygui.ScrollContext) {
 		cellPos := scroll.Start
-		for _, row := range p.Rows {
+		for r, row := range p.Rows {
 			cellPos.X = scroll.Start.X
 			for i, cell := range row {
 				cellRec := rl.Rectangle{cellPos.X, cellPos.Y, p.ColWidths[i], resultRowHeight}
 				if rl.CheckCollisionRecs(cellRec, scroll.View) {
-					drawBasicText(cell, cellPos.X+resultCellPaddingH, cellPos.Y+resultCellPaddingV+1, resultFontSize, PaneFontColor)
+					textColor := PaneFontColor
+					textX := cellPos.X + resultCellPaddingH
+					if r > 0 {
+						// Numbers line up on the right, so their digits do.
+						v := p.QueryResult.Rows[r-1][i]
+						textColor = drawFormattedCell(cellRec, v, p.Formats, p.QueryResult.Columns[i], p.ColRanges[i])
+						if _, isNumber := cellNumber(v); isNumber {
+							textX = cellPos.X + p.ColWidths[i] - resultCellPaddingH - measureBasicText(cell, resultFontSize).X
+						}
+					}
+					drawBasicText(cell, textX, cellPos.Y+resultCellPaddingV+1, resultFontSize, textColor)
 				}
 				cellPos.X += p.ColWidths[i]
 			}
@@ -99,6 +130,9 @@ var resultsCurrentHeight float32 = 0
 
 var latestResults = &QueryResultPanel{}
 
+var resultsExportOpen bool
+var resultsExport = NewExportSettings()
+
 func resultsOpenHeight() float32 {
 	res := resultsHeightFrac * screenHeight
 	if res > resultsMaxHeight {
@@ -152,13 +186,54 @@ func drawLatestResults() {
 		rl.NewColor(98, 85, 101, 255),
 	)
 
+	// Export tab
+	exportTabRect := rl.Rectangle{dividerThickness, tabY, 130 * zoomLevel, tabHeight}
+	if selectedNode != nil {
+		rl.DrawRectangleRounded(exportTabRect, RoundnessPx(exportTabRect, 4), 5, rl.Black)
+		exportText := "Export..."
+		if resultsExportOpen {
+			exportText = "Close"
+		}
+		drawBasicText(exportText, exportTabRect.X+12, tabY+(tabHeight/2)-(tipSize/2), tipSize, PaneFontColor)
+	}
+
 	DoPane(rl.Rectangle{0, screenHeight - resultsCurrentHeight, screenWidth - currentSQLWidth, resultsOpenHeight()}, func(p Pane) {
-		latestResults.Draw(p.Bounds)
+		if !resultsExportOpen || selectedNode == nil {
+			latestResults.Draw(p.Bounds)
+			return
+		}
+
+		const stripPadding = 6 * zoomLevel
+		const stripHeight = stripPadding + UIFieldHeight + stripPadding
+
+		gridBounds := p.Bounds
+		gridBounds.Y += stripHeight
+		gridBounds.Height -= stripHeight
+		latestResults.Draw(gridBounds)
+
+		// export controls go on top of the grid so the dropdowns can overlap it
+		rl.DrawRectangleRec(rl.Rectangle{p.Bounds.X, p.Bounds.Y, p.Bounds.Width, stripHeight}, MainColor())
+		resultsExport.Update()
+		resultsExport.DoRowUI(rl.Rectangle{
+			p.Bounds.X + stripPadding,
+			p.Bounds.Y + stripPadding,
+			p.Bounds.Width - 2*stripPadding,
+			UIFieldHeight,
+		}, func() string {
+			if selectedNode == nil {
+				return ""
+			}
+			return selectedNode.GenerateSql(false)
+		})
 	})
 
 	if rl.CheckCollisionPointRec(rl.GetMousePosition(), tabRect) && rl.IsMouseButtonReleased(rl.MouseLeftButton) {
 		resultsOpen = !resultsOpen
 	}
+	if selectedNode != nil && rl.CheckCollisionPointRec(rl.GetMousePosition(), exportTabRect) && rl.IsMouseButtonReleased(rl.MouseLeftButton) {
+		resultsExportOpen = !resultsExportOpen
+		resultsOpen = true
+	}
 }
 
 func setResultsOpen(open bool) {
@@ -6,8 +6,11 @@ import (
 )
 
 func drawToolbar() {
+	const toolbarRowHeight = 64 * zoomLevel
+	const toolbarRows = 2
+
 	toolbarWidth := int32(rl.GetScreenWidth())
-	toolbarHeight := int32(64 * zoomLevel)
+	toolbarHeight := int32(toolbarRowHeight * toolbarRows)
 	rl.DrawRectangle(0, 0, toolbarWidth, toolbarHeight, rl.ColorAlpha(rl.Black, 0.5))
 	rl.DrawLineEx(
 		rl.Vector2{0, float32(toolbarHeight)},
@@ -24,10 +27,11 @@ func drawToolbar() {
 		n.Sort = nodeSortTop()
 	}
 
+	var rowY float32 = 0
 	buttonRect := func(x, width float32) rl.Rectangle {
 		return rl.Rectangle{
 			X:      x,
-			Y:      float32(toolbarHeight/2) - float32(buttHeight/2),
+			Y:      rowY + toolbarRowHeight/2 - float32(buttHeight/2),
 			Width:  width,
 			Height: float32(buttHeight),
 		}
@@ -125,6 +129,100 @@ func drawToolbar() {
 		},
 	)
 
+	// Second row: cleanup and more specialized nodes
+	rowY += toolbarRowHeight
+	nextX = buttSpacing
+
+	nextX = doToolbarButton(
+		"Clean Up", "Fill in NULLs, convert column types, and tidy up text, one column at a time.",
+		buttonRect(nextX, 160*zoomLevel),
+		CleanupColor,
+		func() *Node {
+			n := NewCleanup()
+			initNewNode(n, rl.Vector2{600, 150})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Top N", "Keep only the first few rows of each group, e.g. the top 3 films per category.",
+		buttonRect(nextX, 120*zoomLevel),
+		TopNColor,
+		func() *Node {
+			n := NewTopN()
+			initNewNode(n, rl.Vector2{450, 250})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Hierarchy", "Walk a tree of rows that point at their parents, adding each row's depth and path.",
+		buttonRect(nextX, 160*zoomLevel),
+		HierarchyColor,
+		func() *Node {
+			n := NewHierarchy()
+			initNewNode(n, rl.Vector2{450, 150})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Extract JSON", "Pull values out of a column of JSON into their own columns, optionally turning arrays into rows.",
+		buttonRect(nextX, 180*zoomLevel),
+		ExtractJSONColor,
+		func() *Node {
+			n := NewExtractJSON()
+			initNewNode(n, rl.Vector2{500, 250})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Search", "Find rows whose text matches some words, best matches first, using a full-text index.",
+		buttonRect(nextX, 120*zoomLevel),
+		SearchColor,
+		func() *Node {
+			n := NewSearch()
+			initNewNode(n, rl.Vector2{450, 200})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Save Table", "Save the results of a query as a new table, so other queries can use it.",
+		buttonRect(nextX, 180*zoomLevel),
+		SaveTableColor,
+		func() *Node {
+			n := NewSaveTable()
+			initNewNode(n, rl.Vector2{450, 200})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Export", "Write the full results of a query to a CSV, JSON, or NDJSON file.",
+		buttonRect(nextX, 120*zoomLevel),
+		ExportColor,
+		func() *Node {
+			n := NewExport()
+			initNewNode(n, rl.Vector2{500, 250})
+			return n
+		},
+	)
+
+	nextX = doToolbarButton(
+		"Import CSV", "Load a CSV file into a new table. You can also drop CSV files onto the window.",
+		buttonRect(nextX, 180*zoomLevel),
+		ImportCSVColor,
+		func() *Node {
+			n := NewImportCSV("")
+			initNewNode(n, rl.Vector2{500, 250})
+			return n
+		},
+	)
+
+	rowY = 0
+
 	doToolbarButton(
 		"Preview", "View the results of a query as you work.",
 		buttonRect(screenWidth-buttSpacing-(160*zoomLevel), 160*zoomLevel),
@@ -147,6 +245,30 @@ func drawToolbar() {
 		},
 	)
 
+	doToolbarButton(
+		"Distribution", "See how the values of a number column are spread out, as a histogram or box plot.",
+		buttonRect(screenWidth-3*buttSpacing-(160*zoomLevel)-(160*zoomLevel)-(200*zoomLevel), 200*zoomLevel),
+		DistributionColor,
+		func() *Node {
+			n := NewDistribution()
+			initNewNode(n, rl.Vector2{600, 400})
+			return n
+		},
+	)
+
+	rowY = toolbarRowHeight
+
+	doToolbarButton(
+		"Pivot", "Summarize a table by the values of some columns, with subtotals for each group.",
+		buttonRect(screenWidth-buttSpacing-(160*zoomLevel), 160*zoomLevel),
+		PivotColor,
+		func() *Node {
+			n := NewPivot()
+			initNewNode(n, rl.Vector2{800, 600})
+			return n
+		},
+	)
+
 	LoadStyleMain()
 
 	rl.DrawRectangle(0, 0, toolbarWidth, toolbarHeight, rl.ColorAlpha(rl.Black, 0.25))
@@ -2,6 +2,10 @@ package app
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"time"
+	"unsafe"
 
 	"github.com/bvisness/SQLJam/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
@@ -23,6 +27,7 @@ func getSchemaOfSqlSource(src SqlSource) ([]string, error) {
 		fmt.Println(err.Error())
 		return nil, err
 	}
+	defer rows.Close()
 	return rows.Columns()
 }
 
@@ -44,6 +49,59 @@ func getSchema(n *Node) []string {
 	return colsToShow
 }
 
+type ColumnKind int
+
+const (
+	KindText ColumnKind = iota
+	KindNumber
+	KindDate
+)
+
+var dateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// getColumnKinds Guesses what kind of data each column of a node holds, based
+// on a sample of its rows. Cached along with the schema.
+func getColumnKinds(n *Node) map[string]ColumnKind {
+	if n.ColumnKinds != nil {
+		return n.ColumnKinds
+	}
+
+	res := doQuery(fmt.Sprintf("SELECT * FROM (\n%s\n) LIMIT 100", n.GenerateSql(false)))
+	kinds := map[string]ColumnKind{}
+	for i, col := range res.Columns {
+		numbers, dates, others := 0, 0, 0
+		for _, row := range res.Rows {
+			switch v := row[i].(type) {
+			case nil:
+			case int64, float64:
+				numbers++
+			case time.Time:
+				dates++
+			case string:
+				if dateRegexp.MatchString(v) {
+					dates++
+				} else {
+					others++
+				}
+			default:
+				others++
+			}
+		}
+
+		switch {
+		case numbers > 0 && dates == 0 && others == 0:
+			kinds[col] = KindNumber
+		case dates > 0 && numbers == 0 && others == 0:
+			kinds[col] = KindDate
+		default:
+			kinds[col] = KindText
+		}
+	}
+
+	n.ColumnKinds = kinds
+	return kinds
+}
+
 var errorOpts = []raygui.DropdownExOption{{"ERROR", "ERROR"}}
 
 // Gets dropdown options for the table produced by the given node.
@@ -75,6 +133,69 @@ func measureBasicText(text string, size float32) rl.Vector2 {
 	return rl.MeasureTextEx(font, text, size*zoomLevel, basicTextSpacingRatio*size)
 }
 
+// drawRotatedBasicText Draws text turned clockwise by degrees around pos, the
+// top left of the unturned text. Our raylib has no DrawTextPro, so this draws
+// each glyph out of the font atlas itself, the same way raylib does.
+func drawRotatedBasicText(text string, pos rl.Vector2, size float32, degrees float32, color rl.Color) {
+	fontSize := size * zoomLevel
+	scale := fontSize / float32(font.BaseSize)
+	spacing := basicTextSpacingRatio * fontSize
+	padding := float32(font.CharsPadding)
+
+	recs := (*[1 << 16]rl.Rectangle)(unsafe.Pointer(font.Recs))[:font.CharsCount:font.CharsCount]
+	chars := (*[1 << 16]rl.CharInfo)(unsafe.Pointer(font.Chars))[:font.CharsCount:font.CharsCount]
+
+	sin, cos := math.Sincos(float64(degrees) * math.Pi / 180)
+	var advance float32
+	for _, r := range text {
+		i := rl.GetGlyphIndex(font, r)
+		rec, char := recs[i], chars[i]
+
+		// where the glyph goes before turning, relative to pos
+		local := rl.Vector2{
+			X: advance + (float32(char.OffsetX)-padding)*scale,
+			Y: (float32(char.OffsetY) - padding) * scale,
+		}
+		if r != ' ' {
+			rl.DrawTexturePro(
+				font.Texture,
+				rl.Rectangle{rec.X - padding, rec.Y - padding, rec.Width + 2*padding, rec.Height + 2*padding},
+				rl.Rectangle{
+					X:      pos.X + local.X*float32(cos) - local.Y*float32(sin),
+					Y:      pos.Y + local.X*float32(sin) + local.Y*float32(cos),
+					Width:  (rec.Width + 2*padding) * scale,
+					Height: (rec.Height + 2*padding) * scale,
+				},
+				rl.Vector2{},
+				degrees,
+				color,
+			)
+		}
+
+		if char.AdvanceX == 0 {
+			advance += rec.Width*scale + spacing
+		} else {
+			advance += float32(char.AdvanceX)*scale + spacing
+		}
+	}
+}
+
+// doLinkText Draws text that can be clicked like a link. It is underlined on
+// hover, and returns true when clicked.
+func doLinkText(text string, x float32, y float32, size float32, color rl.Color) bool {
+	drawBasicText(text, x, y, size, color)
+	if raygui.GetState() == raygui.StateDisabled {
+		return false
+	}
+
+	textSize := measureBasicText(text, size)
+	if !rl.CheckCollisionPointRec(raygui.GetMousePositionWorld(), rl.Rectangle{x, y, textSize.X, textSize.Y}) {
+		return false
+	}
+	rl.DrawLineEx(rl.Vector2{x, y + textSize.Y}, rl.Vector2{x + textSize.X, y + textSize.Y}, 2, color)
+	return rl.IsMouseButtonReleased(rl.MouseLeftButton)
+}
+
 func drawResizeHandle(bottomRight rl.Vector2, nodeColor rl.Color) {
 	rl.DrawLineV(
 		rl.Vector2{bottomRight.X - 10, bottomRight.Y - 2},
@@ -97,6 +97,18 @@ func (d *DropdownEx) SetOptions(opts ...DropdownExOption) {
 	d.str = strings.Join(names, ";")
 }
 
+// Selects the first option with the given value. Returns false if there is no
+// such option, in which case the selection is left alone.
+func (d *DropdownEx) SelectValue(value interface{}) bool {
+	for i, opt := range d.options {
+		if opt.Value == value {
+			d.active = i
+			return true
+		}
+	}
+	return false
+}
+
 func (d *DropdownEx) fixupActive() {
 	if d.active >= len(d.options) {
 		d.active = len(d.options) - 1